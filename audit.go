@@ -0,0 +1,30 @@
+package hibp
+
+import (
+	"context"
+)
+
+// AuditSink is the interface with which you can record every password check
+// made by PwnedClient, such as to an append-only audit log. It only ever
+// receives the 5 character hash prefix, never the suffix or the password.
+type AuditSink interface {
+	// Record records the decision for a check of a password whose hash
+	// has the provided prefix. Count is the number of times the password
+	// appears in breaches, which is 0 if it is unknown such as when the
+	// result came from the Cache.
+	Record(ctx context.Context, prefix string, pwned bool, count int) error
+}
+
+// audit records the decision in the AuditSink, if configured. The returned
+// error is only non-nil if AuditSinkFatal is set.
+func (c *PwnedClient) audit(ctx context.Context, prefix []byte, pwned bool, count int) error {
+	if c.AuditSink == nil {
+		return nil
+	}
+
+	if err := c.AuditSink.Record(ctx, string(prefix), pwned, count); err != nil && c.AuditSinkFatal {
+		return err
+	}
+
+	return nil
+}
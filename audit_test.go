@@ -0,0 +1,107 @@
+package hibp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+)
+
+type testAuditSink struct {
+	RecordFn func(ctx context.Context, prefix string, pwned bool, count int) error
+}
+
+func (s *testAuditSink) Record(ctx context.Context, prefix string, pwned bool, count int) error {
+	return s.RecordFn(ctx, prefix, pwned, count)
+}
+
+func TestAuditSink(t *testing.T) {
+	type record struct {
+		Prefix string
+		Pwned  bool
+		Count  int
+	}
+
+	var records []record
+
+	pwnedClient := PwnedClient{
+		AuditSink: &testAuditSink{
+			RecordFn: func(ctx context.Context, prefix string, pwned bool, count int) error {
+				records = append(records, record{prefix, pwned, count})
+
+				return errors.New("sink unavailable")
+			},
+		},
+		HTTP: &testHTTPClient{
+			Fn: func(r *http.Request) (*http.Response, error) {
+				return &http.Response{
+					StatusCode: http.StatusOK,
+					Status:     "200 OK",
+					Request:    r,
+					Body:       io.NopCloser(bytes.NewReader([]byte("214943DAAD1D64C102FAEC29DE4AFE9DA3D:42\r\n"))),
+				}, nil
+			},
+		},
+	}
+
+	res, err := pwnedClient.Check(context.Background(), "password1")
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	if !res {
+		t.Errorf("Expected result to be true, but was false")
+	}
+
+	pwnedClient.AuditSinkFatal = true
+
+	_, err = pwnedClient.Check(context.Background(), "not pwned")
+	if err == nil || err.Error() != "sink unavailable" {
+		t.Errorf("Expected audit sink error, got %v", err)
+	}
+
+	expected := []record{
+		{"E38AD", true, 42},
+		{"D2005", false, 0},
+	}
+
+	if len(records) != len(expected) {
+		t.Fatalf("Unexpected records %v", records)
+	}
+
+	for i := range expected {
+		if records[i] != expected[i] {
+			t.Errorf("Unexpected record %v expected %v", records[i], expected[i])
+		}
+	}
+}
+
+func TestAuditSinkNotCalledOnError(t *testing.T) {
+	called := false
+
+	pwnedClient := PwnedClient{
+		AuditSink: &testAuditSink{
+			RecordFn: func(ctx context.Context, prefix string, pwned bool, count int) error {
+				called = true
+
+				return nil
+			},
+		},
+		HTTP: &testHTTPClient{
+			Fn: func(r *http.Request) (*http.Response, error) {
+				return nil, context.Canceled
+			},
+		},
+	}
+
+	_, err := pwnedClient.Check(context.Background(), "password1")
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	if called {
+		t.Errorf("AuditSink was called for a failed check")
+	}
+}
@@ -0,0 +1,367 @@
+package hibp
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// defaultBatchConcurrency is the maximum number of concurrent range requests
+// issued by the batch methods on PwnedClient.
+const defaultBatchConcurrency = 8
+
+// Prefetch fetches the ranges for all distinct prefixes of the provided
+// passwords so that they are recorded in the configured Cache. It is like Warm
+// with a context from ContextWithCacheBypass, but does not require a Cache.
+// Results are discarded, only an aggregate of all errors encountered is
+// returned. Passwords sharing a prefix result in a single request.
+func (c *PwnedClient) Prefetch(ctx context.Context, passwords []string) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	return c.warm(ContextWithCacheBypass(ctx), passwords)
+}
+
+// Warm populates the Cache with the ranges of the passwords, such as the most
+// common breached passwords at startup, so that the first checks of them are
+// answered from the Cache. Prefixes the Cache can already answer for are
+// skipped, unless ctx was created with ContextWithCacheBypass, and passwords
+// sharing a prefix result in a single request. Probing the Cache is not
+// reported as cache hits or misses, as no password is checked. At most 8
+// requests are sent concurrently, further limited by MaxConcurrency. It
+// returns early once the context is canceled. An error is returned if no
+// Cache is set.
+func (c *PwnedClient) Warm(ctx context.Context, passwords []string) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	if c.Cache == nil {
+		return errors.New("hibp: Warm requires a Cache")
+	}
+
+	return c.warm(ctx, passwords)
+}
+
+// warm implements Warm and Prefetch, fetching the ranges of the passwords the
+// Cache, if any, cannot answer for.
+func (c *PwnedClient) warm(ctx context.Context, passwords []string) error {
+	prefixes, groups, suffixes, hashErr := c.groupByPrefix(passwords)
+
+	if c.Cache == nil || cacheBypassed(ctx) {
+		return errors.Join(hashErr, c.fetchPrefixes(ctx, prefixes, defaultBatchConcurrency))
+	}
+
+	knownCache, known := c.Cache.(KnownPwnedCache)
+
+	missing := make([][]byte, 0, len(prefixes))
+
+	for _, prefix := range prefixes {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		group := groups[string(prefix)]
+
+		if known {
+			// a known prefix answers for all of its suffixes
+			_, ok, err := knownCache.ContainsKnown(ctx, prefix, suffixes[group[0]])
+			if err != nil {
+				return err
+			}
+
+			if !ok {
+				missing = append(missing, prefix)
+			}
+
+			continue
+		}
+
+		for _, i := range group {
+			contains, err := c.Cache.Contains(ctx, prefix, suffixes[i])
+			if err != nil {
+				return err
+			}
+
+			if !contains {
+				missing = append(missing, prefix)
+				break
+			}
+		}
+	}
+
+	return errors.Join(hashErr, c.fetchPrefixes(ctx, missing, defaultBatchConcurrency))
+}
+
+// PrefetchPrefix fetches the range of the hash prefix so that it is recorded in
+// the configured Cache, such as for predictive caching of prefixes that are
+// hot in access logs, without knowing any password. The prefix must be 5 hex
+// characters and is normalized to uppercase, otherwise ErrorInvalidPrefix is
+// returned. Like Check, it joins a request for the prefix already in flight.
+// The name Prefetch is taken by the method prefetching passwords.
+func (c *PwnedClient) PrefetchPrefix(ctx context.Context, prefix string) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	normalizedPrefix, err := normalizePrefix(prefix)
+	if err != nil {
+		return err
+	}
+
+	return c.withRange(ctx, c.Mode, normalizedPrefix, nil)
+}
+
+// WarmHot fetches the ranges for the provided hash prefixes so that they are
+// recorded in the configured Cache, such as an operator-curated list of the
+// most frequently checked prefixes preloaded at startup. Prefixes must be 5
+// hex characters and are normalized to uppercase. If any prefix is invalid
+// ErrorInvalidPrefix is returned before any requests are sent.
+func (c *PwnedClient) WarmHot(ctx context.Context, prefixes []string) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	normalized := make([][]byte, 0, len(prefixes))
+	seen := make(map[string]struct{}, len(prefixes))
+
+	for _, prefix := range prefixes {
+		normalizedPrefix, err := normalizePrefix(prefix)
+		if err != nil {
+			return err
+		}
+
+		if _, ok := seen[string(normalizedPrefix)]; ok {
+			continue
+		}
+
+		seen[string(normalizedPrefix)] = struct{}{}
+		normalized = append(normalized, normalizedPrefix)
+	}
+
+	return c.fetchPrefixes(ctx, normalized, defaultBatchConcurrency)
+}
+
+// fetchPrefixes fetches the ranges for the provided prefixes using at most
+// concurrency concurrent requests.
+func (c *PwnedClient) fetchPrefixes(ctx context.Context, prefixes [][]byte, concurrency int) error {
+	return forEachPrefix(ctx, prefixes, concurrency, func(prefix []byte) error {
+		return c.withRange(ctx, c.Mode, prefix, nil)
+	})
+}
+
+// forEachPrefix calls fn for each of the prefixes with at most concurrency
+// concurrent calls, returning all errors joined. It stops scheduling new calls
+// once the context is canceled.
+func forEachPrefix(ctx context.Context, prefixes [][]byte, concurrency int, fn func(prefix []byte) error) error {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	var lock sync.Mutex
+	var errs []error
+
+	wg := &sync.WaitGroup{}
+	sem := make(chan struct{}, concurrency)
+
+	for _, prefix := range prefixes {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+
+		if err := ctx.Err(); err != nil {
+			lock.Lock()
+			errs = append(errs, err)
+			lock.Unlock()
+
+			break
+		}
+
+		wg.Add(1)
+		go func(prefix []byte) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			if err := fn(prefix); err != nil {
+				lock.Lock()
+				errs = append(errs, err)
+				lock.Unlock()
+			}
+		}(prefix)
+	}
+
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// CheckMany checks all passwords, returning whether each was found in a breach
+// in input order. Passwords sharing a prefix result in a single request, and at
+// most concurrency requests are sent concurrently, or 8 if concurrency is not
+// positive. The Cache is consulted as with Check. Results of passwords whose
+// range could not be fetched are false, and all errors are returned joined.
+// Once the context is canceled no further requests are sent.
+//
+// The hashes of all passwords are held in memory until CheckMany returns,
+// which is about 80 bytes per password in addition to the results. Split
+// very large inputs into chunks to bound memory use.
+func (c *PwnedClient) CheckMany(ctx context.Context, passwords []string, concurrency int) ([]bool, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	pwned, _, err := c.checkMany(ctx, passwords, concurrency, false)
+
+	return pwned, err
+}
+
+// countMany is like CheckMany, but also returns the occurrence counts of the
+// passwords in input order. As with CheckCount, the Cache is only consulted if
+// it implements CountingPwnedCache.
+func (c *PwnedClient) countMany(ctx context.Context, passwords []string, concurrency int) ([]int, error) {
+	_, counts, err := c.checkMany(ctx, passwords, concurrency, true)
+
+	return counts, err
+}
+
+// checkMany implements CheckMany and countMany, returning occurrence counts
+// only if counting is set.
+func (c *PwnedClient) checkMany(ctx context.Context, passwords []string, concurrency int, counting bool) (pwned []bool, counts []int, err error) {
+	if concurrency < 1 {
+		concurrency = defaultBatchConcurrency
+	}
+
+	pwned = make([]bool, len(passwords))
+
+	if counting {
+		counts = make([]int, len(passwords))
+	}
+
+	countingCache, _ := c.Cache.(CountingPwnedCache)
+
+	useCache := c.Cache != nil && !cacheBypassed(ctx) && (!counting || countingCache != nil)
+
+	prefixes, groups, suffixes, hashErr := c.groupByPrefix(passwords)
+
+	// passwords that could not be hashed are not in any group
+	hashed := 0
+	for _, group := range groups {
+		hashed += len(group)
+	}
+
+	c.countChecks(len(passwords), len(passwords)-hashed)
+
+	err = forEachPrefix(ctx, prefixes, concurrency, func(prefix []byte) (err error) {
+		defer func() {
+			if err != nil {
+				c.stats.errors.Add(int64(len(groups[string(prefix)])))
+			}
+		}()
+
+		// each group is only written to by a single goroutine
+		var pending []int
+
+		for _, i := range groups[string(prefix)] {
+			if !useCache {
+				pending = append(pending, i)
+				continue
+			}
+
+			var count int
+
+			if counting {
+				var ok bool
+
+				count, ok, err = c.cacheCount(ctx, countingCache, prefix, suffixes[i])
+				if err != nil {
+					return err
+				}
+
+				if !ok {
+					pending = append(pending, i)
+					continue
+				}
+
+				pwned[i] = count > 0
+				counts[i] = count
+			} else {
+				contains, known, err := c.cacheContains(ctx, prefix, suffixes[i])
+				if err != nil {
+					return err
+				}
+
+				if !contains && !known {
+					pending = append(pending, i)
+					continue
+				}
+
+				pwned[i] = contains
+			}
+
+			if err := c.audit(ctx, prefix, pwned[i], count); err != nil {
+				return err
+			}
+		}
+
+		if len(pending) == 0 {
+			return nil
+		}
+
+		fetched := make([]int, len(pending))
+
+		if err := c.withRange(ctx, c.Mode, prefix, func(buf *pwnedResultBuffer) {
+			for j, i := range pending {
+				fetched[j] = buf.LookupCount(suffixes[i])
+			}
+		}); err != nil {
+			return err
+		}
+
+		for j, i := range pending {
+			pwned[i] = fetched[j] > 0
+
+			if counting {
+				counts[i] = fetched[j]
+			}
+
+			if err := c.audit(ctx, prefix, fetched[j] > 0, fetched[j]); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	return pwned, counts, errors.Join(hashErr, err)
+}
+
+// groupByPrefix hashes the passwords and groups their indices by prefix, with
+// the prefixes in order of first appearance. Passwords that could not be
+// hashed are left out, and their errors are returned joined.
+func (c *PwnedClient) groupByPrefix(passwords []string) (prefixes [][]byte, groups map[string][]int, suffixes [][]byte, err error) {
+	groups = make(map[string][]int)
+	suffixes = make([][]byte, len(passwords))
+
+	var errs []error
+
+	for i, password := range passwords {
+		prefix, suffix, err := c.hash(password)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		suffixes[i] = suffix
+
+		group, ok := groups[string(prefix)]
+		if !ok {
+			prefixes = append(prefixes, prefix)
+		}
+
+		groups[string(prefix)] = append(group, i)
+	}
+
+	return prefixes, groups, suffixes, errors.Join(errs...)
+}
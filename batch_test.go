@@ -0,0 +1,301 @@
+package hibp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestPrefetch(t *testing.T) {
+	var lock sync.Mutex
+	requested := make(map[string]int)
+	added := make(map[string]int)
+
+	pwnedClient := PwnedClient{
+		Cache: &testPwnedCache{
+			AddFn: func(ctx context.Context, prefix []byte, suffixes [][]byte) error {
+				lock.Lock()
+				defer lock.Unlock()
+
+				added[string(prefix)] += 1
+
+				return nil
+			},
+			ContainsFn: func(ctx context.Context, prefix, suffix []byte) (bool, error) {
+				return false, nil
+			},
+		},
+		HTTP: &testHTTPClient{
+			Fn: func(r *http.Request) (*http.Response, error) {
+				lock.Lock()
+				requested[strings.TrimPrefix(r.URL.Path, "/range/")] += 1
+				lock.Unlock()
+
+				return &http.Response{
+					StatusCode: http.StatusOK,
+					Status:     "200 OK",
+					Request:    r,
+					Body:       io.NopCloser(bytes.NewReader([]byte("0123456789ABCDEF0123456789ABCDEF012:1\r\n"))),
+				}, nil
+			},
+		},
+	}
+
+	// password1 and password1 share the same prefix, password2 does not
+	err := pwnedClient.Prefetch(context.Background(), []string{"password1", "password2", "password1"})
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	if len(requested) != 2 {
+		t.Errorf("Expected 2 distinct prefixes to be requested, got %v", requested)
+	}
+
+	for prefix, count := range requested {
+		if count != 1 {
+			t.Errorf("Prefix %q was requested %d times, expected once", prefix, count)
+		}
+
+		if added[prefix] != 1 {
+			t.Errorf("Prefix %q was added to the cache %d times, expected once", prefix, added[prefix])
+		}
+	}
+}
+
+func TestPrefetchWithErrors(t *testing.T) {
+	pwnedClient := PwnedClient{
+		HTTP: &testHTTPClient{
+			Fn: func(r *http.Request) (*http.Response, error) {
+				return &http.Response{
+					StatusCode: http.StatusServiceUnavailable,
+					Status:     "503 Service Unavailable",
+					Request:    r,
+					Body:       io.NopCloser(bytes.NewReader(nil)),
+				}, nil
+			},
+		},
+	}
+
+	err := pwnedClient.Prefetch(context.Background(), []string{"password1", "password2"})
+
+	var eur *ErrorUnexpectedResponse
+	if !errors.As(err, &eur) {
+		t.Errorf("Expected ErrorUnexpectedResponse, got %v", err)
+	}
+}
+
+func TestPrefetchWithCanceledContext(t *testing.T) {
+	called := false
+
+	pwnedClient := PwnedClient{
+		HTTP: &testHTTPClient{
+			Fn: func(r *http.Request) (*http.Response, error) {
+				called = true
+
+				return nil, context.Canceled
+			},
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := pwnedClient.Prefetch(ctx, []string{"password1"})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	if called {
+		t.Errorf("HTTP client was called with a canceled context")
+	}
+}
+
+func TestWarmHot(t *testing.T) {
+	var lock sync.Mutex
+	requested := make(map[string]int)
+
+	pwnedClient := PwnedClient{
+		HTTP: &testHTTPClient{
+			Fn: func(r *http.Request) (*http.Response, error) {
+				lock.Lock()
+				requested[strings.TrimPrefix(r.URL.Path, "/range/")] += 1
+				lock.Unlock()
+
+				return &http.Response{
+					StatusCode: http.StatusOK,
+					Status:     "200 OK",
+					Request:    r,
+					Body:       io.NopCloser(bytes.NewReader(nil)),
+				}, nil
+			},
+		},
+	}
+
+	err := pwnedClient.WarmHot(context.Background(), []string{"e38ad", "E38AD", "00000"})
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	if len(requested) != 2 || requested["E38AD"] != 1 || requested["00000"] != 1 {
+		t.Errorf("Unexpected requests %v", requested)
+	}
+
+	for _, prefix := range []string{"E38A", "E38ADE", "G38AD"} {
+		err = pwnedClient.WarmHot(context.Background(), []string{"00000", prefix})
+
+		var eip *ErrorInvalidPrefix
+		if !errors.As(err, &eip) {
+			t.Errorf("Expected ErrorInvalidPrefix for %q, got %v", prefix, err)
+		} else if eip.Prefix != prefix {
+			t.Errorf("Unexpected prefix in error %q", eip.Prefix)
+		}
+	}
+
+	if len(requested) != 2 || requested["00000"] != 1 {
+		t.Errorf("Requests were sent despite invalid prefixes %v", requested)
+	}
+}
+
+func TestCheckMany(t *testing.T) {
+	called := int32(0)
+
+	pwnedClient := PwnedClient{
+		// password1 is E38AD214943DAAD1D64C102FAEC29DE4AFE9DA3D
+		// password2 is 2AA60A8FF7FCD473D321E0146AFD9E26DF395147
+		// abc is A9993E364706816ABA3E25717850C26C9CD0D89D
+		HTTP: testRangeClient(&called, map[string]string{
+			"/range/E38AD": "214943DAAD1D64C102FAEC29DE4AFE9DA3D:3\r\n",
+			"/range/2AA60": "A8FF7FCD473D321E0146AFD9E26DF395147:5\r\n",
+			"/range/A9993": "0123456789ABCDEF0123456789ABCDEF012:1\r\n",
+		}),
+	}
+
+	results, err := pwnedClient.CheckMany(context.Background(), []string{"password1", "password2", "password1", "abc", "password1"}, 2)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	expected := []bool{true, true, true, false, true}
+
+	if !slices.Equal(results, expected) {
+		t.Errorf("Unexpected results %v", results)
+	}
+
+	if called != 3 {
+		t.Errorf("Expected 3 HTTP calls, got %d", called)
+	}
+}
+
+func TestCheckManyWithErrors(t *testing.T) {
+	called := int32(0)
+
+	pwnedClient := PwnedClient{
+		HTTP: testRangeClient(&called, map[string]string{
+			"/range/E38AD": "214943DAAD1D64C102FAEC29DE4AFE9DA3D:3\r\n",
+		}),
+	}
+
+	results, err := pwnedClient.CheckMany(context.Background(), []string{"password2", "password1"}, 0)
+
+	var unexpectedResponse *ErrorUnexpectedResponse
+	if !errors.As(err, &unexpectedResponse) {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	if !slices.Equal(results, []bool{false, true}) {
+		t.Errorf("Unexpected results %v", results)
+	}
+}
+
+func TestWarm(t *testing.T) {
+	called := int32(0)
+
+	pwnedClient := PwnedClient{
+		Cache: NewLRUCache(10),
+		HTTP: testRangeClient(&called, map[string]string{
+			"/range/E38AD": "214943DAAD1D64C102FAEC29DE4AFE9DA3D:3\r\n",
+			"/range/2AA60": "A8FF7FCD473D321E0146AFD9E26DF395147:5\r\n",
+		}),
+	}
+
+	if err := pwnedClient.Warm(context.Background(), []string{"password1", "password2", "password1"}); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if called != 2 {
+		t.Errorf("Expected 2 HTTP calls, got %d", called)
+	}
+
+	// already cached prefixes are not fetched again
+	if err := pwnedClient.Warm(context.Background(), []string{"password2", "password1"}); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	for _, password := range []string{"password1", "password2"} {
+		result, err := pwnedClient.Lookup(context.Background(), password)
+		if err != nil || !result.Pwned || !result.FromCache {
+			t.Errorf("Unexpected result %+v %v", result, err)
+		}
+	}
+
+	if called != 2 {
+		t.Errorf("Expected no further HTTP calls, got %d", called)
+	}
+
+	// only the lookups are reported as cache hits
+	if stats := pwnedClient.Stats(); stats.CacheHits != 2 {
+		t.Errorf("Expected 2 cache hits, got %d", stats.CacheHits)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := pwnedClient.Warm(ctx, []string{"password3"}); !errors.Is(err, context.Canceled) {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	pwnedClient.Cache = nil
+
+	if err := pwnedClient.Warm(context.Background(), []string{"password1"}); err == nil {
+		t.Errorf("Expected an error without a Cache")
+	}
+}
+
+func TestPrefetchPrefix(t *testing.T) {
+	calls := 0
+
+	pwnedClient := PwnedClient{
+		Cache: NewLRUCache(10),
+		HTTP:  testStatusSequenceClient(&calls, []int{http.StatusOK}, nil),
+	}
+
+	if err := pwnedClient.PrefetchPrefix(context.Background(), "e38ad"); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	for _, password := range []string{"password1", "password1"} {
+		pwned, err := pwnedClient.Check(context.Background(), password)
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+
+		if !pwned {
+			t.Errorf("Expected result to be true, but was false")
+		}
+	}
+
+	if calls != 1 {
+		t.Errorf("Expected checks to be answered from the cache, got %d calls", calls)
+	}
+
+	var eip *ErrorInvalidPrefix
+	if err := pwnedClient.PrefetchPrefix(context.Background(), "E38A"); !errors.As(err, &eip) {
+		t.Errorf("Expected ErrorInvalidPrefix, got %v", err)
+	}
+}
@@ -0,0 +1,181 @@
+package hibp
+
+import (
+	"container/list"
+	"context"
+	"encoding/binary"
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+// Default parameters of BloomCache, giving a false positive rate of about 1%.
+const (
+	DefaultBloomBitsPerSuffix = 10
+	DefaultBloomHashes        = 7
+)
+
+// BloomCache is an in-memory negative cache holding a bloom filter of the
+// suffixes of at most a fixed number of prefixes. It can answer that a
+// password is definitely not pwned without a request, but never that it is:
+// possible positives fall through to the Pwned Passwords API. As most checked
+// passwords are not pwned, this avoids most requests while using far less
+// memory than LRUCache, about bitsPerSuffix / 8 bytes per suffix (around 1.2KB
+// per prefix with the defaults, compared to around 50KB).
+//
+// The false positive rate, the share of not pwned passwords that still cause
+// a request, is about (1 - e^(-hashes / bitsPerSuffix))^hashes. It is about 1%
+// with the defaults, and every additional bitsPerSuffix roughly halves it.
+// When full, the least recently used prefix is evicted. It is safe for
+// concurrent use.
+type BloomCache struct {
+	// TTL, when positive, is how long the filter of a prefix is used after
+	// it was added. Zero means no expiry. Set it before the cache is used.
+	TTL time.Duration
+
+	maxPrefixes   int
+	bitsPerSuffix int
+	hashes        int
+
+	lock    sync.Mutex
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+// bloomEntry is the value of the elements in BloomCache.order.
+type bloomEntry struct {
+	prefix string
+	bits   []uint64
+
+	// added is when the filter was added
+	added time.Time
+}
+
+// NewBloomCache creates a BloomCache holding the filters of at most
+// maxPrefixes prefixes, using bitsPerSuffix bits and hashes hash functions per
+// suffix. Non-positive values of bitsPerSuffix and hashes use
+// DefaultBloomBitsPerSuffix and DefaultBloomHashes respectively.
+func NewBloomCache(maxPrefixes, bitsPerSuffix, hashes int) *BloomCache {
+	if bitsPerSuffix <= 0 {
+		bitsPerSuffix = DefaultBloomBitsPerSuffix
+	}
+
+	if hashes <= 0 {
+		hashes = DefaultBloomHashes
+	}
+
+	return &BloomCache{
+		maxPrefixes:   max(maxPrefixes, 1),
+		bitsPerSuffix: bitsPerSuffix,
+		hashes:        hashes,
+		order:         list.New(),
+		entries:       make(map[string]*list.Element),
+	}
+}
+
+// bloomHashes returns the two hashes of the suffix from which the positions in
+// the filter are derived.
+func bloomHashes(suffix []byte) (uint64, uint64) {
+	hash := fnv.New128a()
+	hash.Write(suffix)
+
+	sum := hash.Sum(nil)
+
+	// the second hash must not be 0, otherwise all positions are the same
+	return binary.BigEndian.Uint64(sum[:8]), binary.BigEndian.Uint64(sum[8:]) | 1
+}
+
+// Add records a filter of the suffixes of the prefix, replacing any previously
+// recorded for it, and evicts the least recently used prefix if the cache is
+// full.
+func (c *BloomCache) Add(ctx context.Context, prefix []byte, suffixes [][]byte) error {
+	entry := &bloomEntry{
+		prefix: string(prefix),
+		bits:   make([]uint64, (max(len(suffixes)*c.bitsPerSuffix, 1)+63)/64),
+		added:  now(),
+	}
+
+	size := uint64(len(entry.bits) * 64)
+
+	for _, suffix := range suffixes {
+		h1, h2 := bloomHashes(suffix)
+
+		for i := 0; i < c.hashes; i += 1 {
+			position := (h1 + uint64(i)*h2) % size
+			entry.bits[position/64] |= 1 << (position % 64)
+		}
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if element, ok := c.entries[entry.prefix]; ok {
+		element.Value = entry
+		c.order.MoveToFront(element)
+
+		return nil
+	}
+
+	c.entries[entry.prefix] = c.order.PushFront(entry)
+
+	for c.order.Len() > c.maxPrefixes {
+		oldest := c.order.Back()
+
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*bloomEntry).prefix)
+	}
+
+	return nil
+}
+
+// Contains always returns false, as a bloom filter can never tell for sure
+// that a suffix was recorded.
+func (c *BloomCache) Contains(ctx context.Context, prefix, suffix []byte) (bool, error) {
+	return false, nil
+}
+
+// ContainsKnown reports the suffix as known to be absent if the filter of the
+// prefix rules it out, marking the prefix as recently used. Otherwise the
+// suffix may be pwned and it is reported as unknown. Contains is always false.
+func (c *BloomCache) ContainsKnown(ctx context.Context, prefix, suffix []byte) (contains, known bool, err error) {
+	h1, h2 := bloomHashes(suffix)
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	element, ok := c.entries[string(prefix)]
+	if !ok {
+		return false, false, nil
+	}
+
+	entry := element.Value.(*bloomEntry)
+
+	if c.TTL > 0 && now().Sub(entry.added) >= c.TTL {
+		c.order.Remove(element)
+		delete(c.entries, entry.prefix)
+
+		return false, false, nil
+	}
+
+	c.order.MoveToFront(element)
+
+	size := uint64(len(entry.bits) * 64)
+
+	for i := 0; i < c.hashes; i += 1 {
+		position := (h1 + uint64(i)*h2) % size
+
+		if entry.bits[position/64]&(1<<(position%64)) == 0 {
+			return false, true, nil
+		}
+	}
+
+	return false, false, nil
+}
+
+// Len returns the number of prefixes in the cache.
+func (c *BloomCache) Len() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.order.Len()
+}
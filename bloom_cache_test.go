@@ -0,0 +1,86 @@
+package hibp
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestBloomCache(t *testing.T) {
+	cache := NewBloomCache(2, 0, 0)
+	ctx := context.Background()
+
+	suffixes := make([][]byte, 1000)
+	for i := range suffixes {
+		suffixes[i] = []byte(fmt.Sprintf("%035X", i))
+	}
+
+	if err := cache.Add(ctx, []byte("00000"), suffixes); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	for _, suffix := range suffixes {
+		contains, known, err := cache.ContainsKnown(ctx, []byte("00000"), suffix)
+		if err != nil || contains || known {
+			t.Fatalf("Unexpected result for added suffix %s %v %v %v", suffix, contains, known, err)
+		}
+	}
+
+	falsePositives := 0
+
+	for i := 0; i < 10000; i += 1 {
+		_, known, _ := cache.ContainsKnown(ctx, []byte("00000"), []byte(fmt.Sprintf("%035X", 1_000_000+i)))
+		if !known {
+			falsePositives += 1
+		}
+	}
+
+	if falsePositives > 300 {
+		t.Errorf("Expected about 1%% false positives, got %d of 10000", falsePositives)
+	}
+
+	if _, known, _ := cache.ContainsKnown(ctx, []byte("00001"), suffixes[0]); known {
+		t.Errorf("Expected missing prefix not to be known")
+	}
+
+	cache.Add(ctx, []byte("00001"), nil)
+	cache.Add(ctx, []byte("00002"), nil)
+
+	if cache.Len() != 2 {
+		t.Errorf("Expected 2 prefixes, got %d", cache.Len())
+	}
+
+	if _, known, _ := cache.ContainsKnown(ctx, []byte("00000"), []byte(fmt.Sprintf("%035X", 1_000_000))); known {
+		t.Errorf("Expected least recently used prefix to be evicted")
+	}
+}
+
+func TestBloomCacheWithClient(t *testing.T) {
+	calls := 0
+
+	pwnedClient := PwnedClient{
+		Cache: NewBloomCache(10, 0, 0),
+		HTTP:  testStatusSequenceClient(&calls, []int{http.StatusOK}, nil),
+	}
+
+	for _, password := range []string{"password1", "password1"} {
+		res, err := pwnedClient.Check(context.Background(), password)
+		if err != nil || !res {
+			t.Errorf("Unexpected result %v %v", res, err)
+		}
+	}
+
+	if calls != 2 {
+		t.Errorf("Expected possible positives to be checked with a request, got %d calls", calls)
+	}
+
+	res, err := pwnedClient.CheckHash(context.Background(), "E38AD00000000000000000000000000000000000")
+	if err != nil || res {
+		t.Errorf("Unexpected result %v %v", res, err)
+	}
+
+	if calls != 2 {
+		t.Errorf("Expected absent suffix to be answered from the cache, got %d calls", calls)
+	}
+}
@@ -0,0 +1,154 @@
+package hibp
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// DefaultBreachBaseURL is the base URL of the HaveIBeenPwned.org API used by
+// BreachClient when BreachClient.BaseURL is not set.
+const DefaultBreachBaseURL = "https://haveibeenpwned.com/api/v3/"
+
+// Breach holds the metadata of a breach from the HaveIBeenPwned.org API.
+type Breach struct {
+	// Name uniquely identifies the breach.
+	Name string `json:"Name"`
+
+	// Title is the descriptive name of the breach.
+	Title string `json:"Title"`
+
+	// Domain is the primary domain of the breached service, if any.
+	Domain string `json:"Domain"`
+
+	// BreachDate is the date the breach occurred, as YYYY-MM-DD.
+	BreachDate string `json:"BreachDate"`
+
+	// AddedDate is when the breach was added to HaveIBeenPwned.org.
+	AddedDate time.Time `json:"AddedDate"`
+
+	// ModifiedDate is when the breach was last modified.
+	ModifiedDate time.Time `json:"ModifiedDate"`
+
+	// PwnCount is the number of accounts in the breach.
+	PwnCount int `json:"PwnCount"`
+
+	// Description is an HTML description of the breach.
+	Description string `json:"Description"`
+
+	// DataClasses lists the kinds of data in the breach, such as
+	// "Passwords" or "Email addresses".
+	DataClasses []string `json:"DataClasses"`
+
+	// LogoPath is the URL of the logo of the breached service.
+	LogoPath string `json:"LogoPath"`
+
+	IsVerified   bool `json:"IsVerified"`
+	IsFabricated bool `json:"IsFabricated"`
+	IsSensitive  bool `json:"IsSensitive"`
+	IsRetired    bool `json:"IsRetired"`
+	IsSpamList   bool `json:"IsSpamList"`
+	IsMalware    bool `json:"IsMalware"`
+}
+
+// BreachClient can be used to send requests to the breached account API of
+// HaveIBeenPwned.org, which requires an API key. Zero value is usable apart
+// from the missing APIKey, though like with PwnedClient it is highly
+// recommended you configure the UserAgent property.
+type BreachClient struct {
+	// APIKey is sent in the hibp-api-key header of requests.
+	APIKey string
+
+	// UserAgent, if set, is used as the User-Agent header instead of
+	// DefaultUserAgent. Like with PwnedClient, it can be overridden per
+	// request with ContextWithUserAgent.
+	UserAgent string
+
+	// BaseURL, if set, is used instead of DefaultBreachBaseURL, such as
+	// for a proxy or a test server. It must end with a slash.
+	BaseURL string
+
+	// HTTP is the client used to send requests. If not set, a shared
+	// client with DefaultTransport is used.
+	HTTP interface {
+		Do(req *http.Request) (*http.Response, error)
+	}
+}
+
+// BreachedAccount returns the breaches the account with the email address (or
+// username) appears in, with full metadata. An account that is not in any
+// breach returns an empty slice. A missing or invalid APIKey returns
+// ErrorUnauthorized.
+func (c *BreachClient) BreachedAccount(ctx context.Context, email string) ([]Breach, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	baseURL := c.BaseURL
+	if baseURL == "" {
+		baseURL = DefaultBreachBaseURL
+	}
+
+	requestURL := baseURL + "breachedaccount/" + url.PathEscape(email) + "?truncateResponse=false"
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, requestURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	userAgent := userAgentFromContext(ctx)
+
+	if userAgent == "" {
+		userAgent = c.UserAgent
+	}
+
+	if userAgent == "" {
+		userAgent = DefaultUserAgent
+	}
+
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("hibp-api-key", c.APIKey)
+
+	var client httpDoer = sharedHTTPClient()
+	if c.HTTP != nil {
+		client = c.HTTP
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusOK:
+		var breaches []Breach
+
+		if err := json.NewDecoder(io.LimitReader(res.Body, DefaultMaxResponseBytes)).Decode(&breaches); err != nil {
+			return nil, err
+		}
+
+		if breaches == nil {
+			breaches = []Breach{}
+		}
+
+		return breaches, nil
+
+	case http.StatusNotFound:
+		return []Breach{}, nil
+
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return nil, &ErrorUnauthorized{
+			Response: res,
+		}
+
+	case http.StatusTooManyRequests:
+		return nil, newErrorRateLimited(res)
+	}
+
+	return nil, newErrorUnexpectedResponse(res)
+}
@@ -0,0 +1,111 @@
+package hibp
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestBreachClientBreachedAccount(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("hibp-api-key") != "key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		if r.Header.Get("User-Agent") != "test" {
+			t.Errorf("Unexpected User-Agent %q", r.Header.Get("User-Agent"))
+		}
+
+		if r.URL.Query().Get("truncateResponse") != "false" {
+			t.Errorf("Expected untruncated response")
+		}
+
+		switch r.URL.Path {
+		case "/breachedaccount/pwned@example.com":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`[{"Name":"Adobe","Title":"Adobe","Domain":"adobe.com","BreachDate":"2013-10-04","AddedDate":"2013-12-04T00:00:00Z","PwnCount":152445165,"DataClasses":["Email addresses","Passwords"],"IsVerified":true}]`))
+
+		case "/breachedaccount/clean@example.com":
+			w.WriteHeader(http.StatusNotFound)
+
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	breachClient := BreachClient{
+		APIKey:    "key",
+		UserAgent: "test",
+		BaseURL:   server.URL + "/",
+	}
+
+	breaches, err := breachClient.BreachedAccount(context.Background(), "pwned@example.com")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if len(breaches) != 1 {
+		t.Fatalf("Unexpected breaches %+v", breaches)
+	}
+
+	breach := breaches[0]
+
+	if breach.Name != "Adobe" || breach.Domain != "adobe.com" || breach.BreachDate != "2013-10-04" || breach.PwnCount != 152445165 || !breach.IsVerified || len(breach.DataClasses) != 2 || breach.AddedDate.Year() != 2013 {
+		t.Errorf("Unexpected breach %+v", breach)
+	}
+
+	breaches, err = breachClient.BreachedAccount(context.Background(), "clean@example.com")
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	if breaches == nil || len(breaches) != 0 {
+		t.Errorf("Expected an empty slice, got %+v", breaches)
+	}
+
+	_, err = breachClient.BreachedAccount(context.Background(), "error@example.com")
+
+	var eur *ErrorUnexpectedResponse
+	if !errors.As(err, &eur) || eur.Response.StatusCode != http.StatusInternalServerError {
+		t.Errorf("Expected ErrorUnexpectedResponse, got %v", err)
+	}
+
+	breachClient.APIKey = "invalid"
+
+	_, err = breachClient.BreachedAccount(context.Background(), "pwned@example.com")
+
+	var eu *ErrorUnauthorized
+	if !errors.As(err, &eu) || eu.Response.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected ErrorUnauthorized, got %v", err)
+	}
+}
+
+func TestBreachClientUserAgentFromContext(t *testing.T) {
+	var userAgents []string
+
+	breachClient := BreachClient{
+		UserAgent: "shared",
+		HTTP: &testHTTPClient{
+			Fn: func(r *http.Request) (*http.Response, error) {
+				userAgents = append(userAgents, r.UserAgent())
+
+				return nil, context.Canceled
+			},
+		},
+	}
+
+	breachClient.BreachedAccount(ContextWithUserAgent(context.Background(), "tenant"), "pwned@example.com")
+	breachClient.BreachedAccount(context.Background(), "pwned@example.com")
+
+	breachClient.UserAgent = ""
+	breachClient.BreachedAccount(context.Background(), "pwned@example.com")
+
+	if !reflect.DeepEqual(userAgents, []string{"tenant", "shared", DefaultUserAgent}) {
+		t.Errorf("Unexpected User-Agents %q", userAgents)
+	}
+}
@@ -0,0 +1,119 @@
+package hibp
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DefaultBreakerCooldown is how long the circuit breaker stays open when
+// PwnedClient.BreakerCooldown is not set.
+const DefaultBreakerCooldown = 30 * time.Second
+
+// circuitBreaker stops requests to the Pwned Passwords API after consecutive
+// failures. It is closed while requests succeed, opens after BreakerThreshold
+// consecutive failures, and is half-open once the cooldown has passed, letting
+// a single probe request through whose outcome closes or opens it again.
+type circuitBreaker struct {
+	lock sync.Mutex
+
+	failures int
+	openedAt time.Time
+	open     bool
+	probing  bool
+}
+
+// allowRequest returns ErrorCircuitOpen if the breaker does not let a request
+// through. Otherwise the outcome of the request must be recorded with
+// recordRequest, passing on probe, which is set if the request is the single
+// probe of a half-open breaker.
+func (c *PwnedClient) allowRequest() (probe bool, err error) {
+	if c.BreakerThreshold <= 0 {
+		return false, nil
+	}
+
+	b := &c.breaker
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if !b.open {
+		return false, nil
+	}
+
+	until := b.openedAt.Add(c.breakerCooldown())
+
+	if b.probing || now().Before(until) {
+		return false, &ErrorCircuitOpen{
+			Until: until,
+		}
+	}
+
+	// half-open, this request is the probe
+	b.probing = true
+
+	return true, nil
+}
+
+// recordRequest records the outcome of a request let through by allowRequest.
+// Transport errors and 5xx responses are failures, other responses successes.
+// Cancellation and errors after a response was received are neither. Only the
+// probe frees the breaker for another probe, so that requests sent before the
+// breaker opened cannot.
+func (c *PwnedClient) recordRequest(probe bool, res *http.Response, err error) {
+	if c.BreakerThreshold <= 0 {
+		return
+	}
+
+	var transport *ErrorTransport
+
+	failed := false
+	succeeded := false
+
+	switch {
+	case errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded):
+
+	case errors.As(err, &transport):
+		failed = true
+
+	case err != nil:
+
+	case res != nil:
+		failed = res.StatusCode >= http.StatusInternalServerError
+		succeeded = !failed
+	}
+
+	b := &c.breaker
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if probe {
+		b.probing = false
+	}
+
+	switch {
+	case failed:
+		b.failures += 1
+
+		if probe || b.failures >= c.BreakerThreshold {
+			b.open = true
+			b.openedAt = now()
+		}
+
+	case succeeded:
+		b.failures = 0
+		b.open = false
+	}
+}
+
+// breakerCooldown returns the effective BreakerCooldown.
+func (c *PwnedClient) breakerCooldown() time.Duration {
+	if c.BreakerCooldown <= 0 {
+		return DefaultBreakerCooldown
+	}
+
+	return c.BreakerCooldown
+}
@@ -0,0 +1,149 @@
+package hibp
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	clock := useFakeClock(t)
+
+	calls := 0
+
+	pwnedClient := PwnedClient{
+		BreakerThreshold: 2,
+		BreakerCooldown:  time.Minute,
+		HTTP: testStatusSequenceClient(&calls, []int{
+			http.StatusServiceUnavailable,
+			http.StatusServiceUnavailable,
+			http.StatusBadGateway,
+			http.StatusOK,
+		}, nil),
+	}
+
+	check := func() error {
+		_, err := pwnedClient.Check(context.Background(), "password1")
+		return err
+	}
+
+	var eur *ErrorUnexpectedResponse
+	var eco *ErrorCircuitOpen
+
+	// closed, failures below the threshold
+	if err := check(); !errors.As(err, &eur) {
+		t.Fatalf("Expected ErrorUnexpectedResponse, got %v", err)
+	}
+
+	// the threshold is reached, which opens the breaker
+	if err := check(); !errors.As(err, &eur) {
+		t.Fatalf("Expected ErrorUnexpectedResponse, got %v", err)
+	}
+
+	if err := check(); !errors.As(err, &eco) {
+		t.Fatalf("Expected ErrorCircuitOpen, got %v", err)
+	}
+
+	if calls != 2 {
+		t.Fatalf("Expected no request while open, got %d calls", calls)
+	}
+
+	if failOpen, err := pwnedClient.CheckFailOpen(context.Background(), "password1"); failOpen || err != nil {
+		t.Errorf("Expected CheckFailOpen to fail open, got %v %v", failOpen, err)
+	}
+
+	clock.Advance(time.Minute - time.Second)
+
+	if err := check(); !errors.As(err, &eco) {
+		t.Fatalf("Expected ErrorCircuitOpen before the cooldown passed, got %v", err)
+	}
+
+	// half-open, the failing probe opens the breaker again
+	clock.Advance(time.Second)
+
+	if err := check(); !errors.As(err, &eur) {
+		t.Fatalf("Expected ErrorUnexpectedResponse, got %v", err)
+	}
+
+	if err := check(); !errors.As(err, &eco) {
+		t.Fatalf("Expected ErrorCircuitOpen, got %v", err)
+	}
+
+	// half-open, the successful probe closes the breaker
+	clock.Advance(time.Minute)
+
+	if err := check(); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if err := check(); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if calls != 5 {
+		t.Errorf("Expected 5 calls, got %d", calls)
+	}
+}
+
+func TestCircuitBreakerDisabled(t *testing.T) {
+	calls := 0
+
+	pwnedClient := PwnedClient{
+		HTTP: testStatusSequenceClient(&calls, []int{http.StatusServiceUnavailable}, nil),
+	}
+
+	for i := 0; i < 10; i += 1 {
+		pwnedClient.Check(context.Background(), "password1")
+	}
+
+	if calls != 10 {
+		t.Errorf("Expected 10 calls, got %d", calls)
+	}
+}
+
+func TestCircuitBreakerOutcomes(t *testing.T) {
+	clock := useFakeClock(t)
+
+	pwnedClient := PwnedClient{
+		BreakerThreshold: 2,
+		BreakerCooldown:  time.Minute,
+	}
+
+	ok := &http.Response{StatusCode: http.StatusOK}
+	unavailable := &http.Response{StatusCode: http.StatusServiceUnavailable}
+
+	pwnedClient.recordRequest(false, unavailable, nil)
+
+	// a successful status with garbage in it does not reset the failures
+	pwnedClient.recordRequest(false, ok, &ErrorMalformedResponse{Lines: 3, Response: ok})
+
+	pwnedClient.recordRequest(false, unavailable, nil)
+
+	if _, err := pwnedClient.allowRequest(); err == nil {
+		t.Fatalf("Expected the breaker to be open")
+	}
+
+	clock.Advance(time.Minute)
+
+	probe, err := pwnedClient.allowRequest()
+	if err != nil || !probe {
+		t.Fatalf("Expected a probe to be let through, got %v %v", probe, err)
+	}
+
+	// a request sent before the breaker opened completes, which does not
+	// free the probe slot
+	pwnedClient.recordRequest(false, nil, context.Canceled)
+
+	var eco *ErrorCircuitOpen
+	if _, err := pwnedClient.allowRequest(); !errors.As(err, &eco) {
+		t.Fatalf("Expected ErrorCircuitOpen while probing, got %v", err)
+	}
+
+	pwnedClient.recordRequest(probe, ok, nil)
+
+	if probe, err := pwnedClient.allowRequest(); err != nil || probe {
+		t.Errorf("Expected the breaker to be closed, got %v %v", probe, err)
+	}
+}
@@ -0,0 +1,27 @@
+package hibp
+
+import (
+	"context"
+)
+
+// cacheBypassContextKey is the context key set with ContextWithCacheBypass.
+type cacheBypassContextKey struct{}
+
+// ContextWithCacheBypass returns a context that makes PwnedClient checks made
+// with it skip consulting the Cache and fetch the range from the Pwned
+// Passwords API, such as for a "recheck" button or after a known dataset
+// update. The fresh range is still recorded in the Cache, so later checks
+// benefit from it. A check may still join a request for the prefix that is
+// already in flight, as its result is just as fresh, but does not reuse a
+// completed one held for PwnedClient.ReuseWindow.
+func ContextWithCacheBypass(ctx context.Context) context.Context {
+	return context.WithValue(ctx, cacheBypassContextKey{}, true)
+}
+
+// cacheBypassed reports whether the context was created with
+// ContextWithCacheBypass.
+func cacheBypassed(ctx context.Context) bool {
+	bypassed, _ := ctx.Value(cacheBypassContextKey{}).(bool)
+
+	return bypassed
+}
@@ -0,0 +1,51 @@
+package hibp
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+func TestContextWithCacheBypass(t *testing.T) {
+	calls := 0
+
+	cache := NewLRUCache(10)
+
+	pwnedClient := PwnedClient{
+		Cache: cache,
+		HTTP:  testStatusSequenceClient(&calls, []int{http.StatusOK}, nil),
+	}
+
+	bypass := ContextWithCacheBypass(context.Background())
+
+	for _, ctx := range []context.Context{context.Background(), context.Background(), bypass, context.Background()} {
+		pwned, err := pwnedClient.Check(ctx, "password1")
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+
+		if !pwned {
+			t.Errorf("Expected result to be true, but was false")
+		}
+	}
+
+	if calls != 2 {
+		t.Errorf("Expected 2 calls, got %d", calls)
+	}
+
+	if _, err := pwnedClient.CheckMany(bypass, []string{"password1"}, 1); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if err := pwnedClient.Warm(bypass, []string{"password1"}); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if calls != 4 {
+		t.Errorf("Expected the batch methods to bypass the cache too, got %d calls", calls)
+	}
+
+	if cache.Len() != 1 {
+		t.Errorf("Expected the fresh range to be recorded in the cache")
+	}
+}
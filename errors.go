@@ -1,17 +1,279 @@
 package hibp
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"time"
 )
 
+// ErrClosed is returned by checks started after PwnedClient.Close was called.
+var ErrClosed = errors.New("hibp: PwnedClient is closed")
+
+// ErrMissingUserAgent is returned by checks if PwnedClient.StrictUserAgent is
+// set but no User-Agent other than DefaultUserAgent is.
+var ErrMissingUserAgent = errors.New("hibp: A descriptive User-Agent is required, set PwnedClient.UserAgent")
+
+// ErrCertificateNotPinned is returned if the certificate chain of a server
+// contains none of PwnedClient.PinnedPublicKeys.
+var ErrCertificateNotPinned = errors.New("hibp: No certificate of the server matches PinnedPublicKeys")
+
+// maxBodySnippet is the number of bytes of the body of an unexpected response
+// kept in ErrorUnexpectedResponse.Body.
+const maxBodySnippet = 512
+
 // ErrorUnexpectedResponse is an error returned if the response from the
 // HaveIBeenPwned.org API was not expected.
 type ErrorUnexpectedResponse struct {
-	// Response that was not expected.
+	// Response that was not expected. Its body has already been read.
 	Response *http.Response
+
+	// Body holds up to the first 512 bytes of the body of the response,
+	// which usually explains the error.
+	Body []byte
 }
 
 func (e *ErrorUnexpectedResponse) Error() string {
-	return fmt.Sprintf("hibp: Unexpected HTTP Response %q from %s %q", e.Response.Status, e.Response.Request.Method, e.Response.Request.URL.String())
+	message := fmt.Sprintf("hibp: Unexpected HTTP Response %q from %s %q", e.Response.Status, e.Response.Request.Method, e.Response.Request.URL.String())
+
+	if body := bytes.TrimSpace(e.Body); len(body) > 0 {
+		message += fmt.Sprintf(": %q", body)
+	}
+
+	return message
+}
+
+// snippetBody replaces the body of unexpected responses shared between
+// callers, holding the snippet read from the original body. Reading it
+// returns io.EOF, as the original body has been closed.
+type snippetBody struct {
+	snippet []byte
+}
+
+func (b *snippetBody) Read(into []byte) (int, error) {
+	return 0, io.EOF
+}
+
+func (b *snippetBody) Close() error {
+	return nil
+}
+
+// readBodySnippet reads up to maxBodySnippet bytes of the body. Read errors
+// are ignored, as the snippet is only informational.
+func readBodySnippet(body io.Reader) []byte {
+	snippet, _ := io.ReadAll(io.LimitReader(body, maxBodySnippet))
+
+	return snippet
+}
+
+// newErrorUnexpectedResponse returns an ErrorUnexpectedResponse for the
+// response, with a snippet of its body.
+func newErrorUnexpectedResponse(res *http.Response) *ErrorUnexpectedResponse {
+	e := &ErrorUnexpectedResponse{
+		Response: res,
+	}
+
+	if body, ok := res.Body.(*snippetBody); ok {
+		e.Body = body.snippet
+	} else if res.Body != nil {
+		e.Body = readBodySnippet(res.Body)
+	}
+
+	return e
+}
+
+// ErrorUnauthorized is returned by BreachClient if the HaveIBeenPwned.org API
+// responded with 401 Unauthorized, such as for a missing or invalid API key, or
+// 403 Forbidden, such as for a missing User-Agent.
+type ErrorUnauthorized struct {
+	// Response that was not authorized.
+	Response *http.Response
+}
+
+func (e *ErrorUnauthorized) Error() string {
+	return fmt.Sprintf("hibp: Unauthorized HTTP Response %q from %s %q, check the API key", e.Response.Status, e.Response.Request.Method, e.Response.Request.URL.String())
+}
+
+// ErrorTransport is returned if a request to the Pwned Passwords API failed
+// without a response, such as due to a DNS, connection or TLS failure. Use it
+// to tell unavailability of the API apart from its results, such as to fail
+// open. It wraps the underlying error, so errors.Is(err, context.Canceled)
+// still works.
+type ErrorTransport struct {
+	// Prefix is the prefix that was requested.
+	Prefix string
+
+	// URL is the URL that was requested.
+	URL string
+
+	// Err is the underlying error.
+	Err error
+}
+
+func (e *ErrorTransport) Error() string {
+	return fmt.Sprintf("hibp: Request for prefix %q to %q failed: %v", e.Prefix, e.URL, e.Err)
+}
+
+func (e *ErrorTransport) Unwrap() error {
+	return e.Err
+}
+
+// ErrorCircuitOpen is returned without sending a request while the circuit
+// breaker enabled with PwnedClient.BreakerThreshold is open after consecutive
+// failures of the Pwned Passwords API.
+type ErrorCircuitOpen struct {
+	// Until is when a request is let through again to probe whether the
+	// API has recovered.
+	Until time.Time
+}
+
+func (e *ErrorCircuitOpen) Error() string {
+	return fmt.Sprintf("hibp: Circuit breaker is open until %s after consecutive failures", e.Until.Format(time.RFC3339))
+}
+
+// ErrorMalformedResponse is returned if a successful response from the Pwned
+// Passwords API contains lines but none of them are valid, such as an HTML
+// page served with 200 OK by a proxy. An empty response is valid.
+type ErrorMalformedResponse struct {
+	// Lines is the number of non-empty lines in the response.
+	Lines int
+
+	// Bytes is the size of the response, after decompression.
+	Bytes int64
+
+	// Response that was malformed.
+	Response *http.Response
+}
+
+func (e *ErrorMalformedResponse) Error() string {
+	return fmt.Sprintf("hibp: Malformed response, none of its %d lines (%d bytes) are valid", e.Lines, e.Bytes)
+}
+
+// ErrorTooManyEntries is returned if a response from the Pwned Passwords API
+// contains more lines than allowed by PwnedClient.MaxEntries.
+type ErrorTooManyEntries struct {
+	// Limit is the maximum number of lines that was allowed.
+	Limit int
+}
+
+func (e *ErrorTooManyEntries) Error() string {
+	return fmt.Sprintf("hibp: Response contains more than %d entries", e.Limit)
+}
+
+// ErrorResponseTooLarge is returned if a response from the Pwned Passwords API
+// is larger than allowed by PwnedClient.MaxResponseBytes.
+type ErrorResponseTooLarge struct {
+	// Limit is the maximum number of bytes that was allowed.
+	Limit int64
+}
+
+func (e *ErrorResponseTooLarge) Error() string {
+	return fmt.Sprintf("hibp: Response is larger than %d bytes", e.Limit)
+}
+
+// ErrorUnexpectedContentType is returned if a successful response from the
+// Pwned Passwords API does not have a text Content-Type, such as an HTML page
+// from a misconfigured proxy.
+type ErrorUnexpectedContentType struct {
+	// ContentType is the Content-Type of the response.
+	ContentType string
+
+	// Response with the unexpected Content-Type.
+	Response *http.Response
+}
+
+func (e *ErrorUnexpectedContentType) Error() string {
+	return fmt.Sprintf("hibp: Unexpected Content-Type %q of response, expected text", e.ContentType)
+}
+
+// ErrorInvalidPrefix is returned if a hash prefix is not exactly 5 hex
+// characters.
+type ErrorInvalidPrefix struct {
+	// Prefix is the invalid prefix.
+	Prefix string
+}
+
+func (e *ErrorInvalidPrefix) Error() string {
+	return fmt.Sprintf("hibp: Invalid hash prefix %q, must be 5 hex characters", e.Prefix)
+}
+
+// ErrorPrefixMismatch is returned if PwnedClient.ValidatePrefixMatch is set and
+// a response was served from a URL that is not for the requested prefix.
+type ErrorPrefixMismatch struct {
+	// Prefix is the prefix that was requested.
+	Prefix string
+
+	// Response that was served for a different prefix.
+	Response *http.Response
+}
+
+func (e *ErrorPrefixMismatch) Error() string {
+	url := ""
+	if e.Response.Request != nil && e.Response.Request.URL != nil {
+		url = e.Response.Request.URL.String()
+	}
+
+	return fmt.Sprintf("hibp: Response for prefix %q was served from %q", e.Prefix, url)
+}
+
+// ErrorTooFewEntries is returned if a successful response from the Pwned
+// Passwords API contains fewer valid lines than PwnedClient.MinEntries.
+type ErrorTooFewEntries struct {
+	// Minimum is the number of lines that was required.
+	Minimum int
+
+	// Entries is the number of valid lines in the response.
+	Entries int
+}
+
+func (e *ErrorTooFewEntries) Error() string {
+	return fmt.Sprintf("hibp: Response contains %d entries, expected at least %d", e.Entries, e.Minimum)
+}
+
+// ErrorInvalidHash is returned if a password hash is not a hex string of the
+// expected length.
+type ErrorInvalidHash struct {
+	// Hash is the invalid hash.
+	Hash string
+	// Length is the expected length of the hash in hex characters, 40 for
+	// SHA-1 and 32 for NTLM.
+	Length int
+}
+
+func (e *ErrorInvalidHash) Error() string {
+	return fmt.Sprintf("hibp: Invalid password hash of length %d, must be %d hex characters", len(e.Hash), e.Length)
+}
+
+// DefaultRetryAfter is used as ErrorRateLimited.RetryAfter when the response
+// has no valid Retry-After header.
+const DefaultRetryAfter = 5 * time.Second
+
+// ErrorRateLimited is returned if the HaveIBeenPwned.org API responded with 429
+// Too Many Requests, meaning the request should be retried later.
+type ErrorRateLimited struct {
+	// RetryAfter is how long to wait before retrying, from the
+	// Retry-After header or DefaultRetryAfter if it is missing.
+	RetryAfter time.Duration
+
+	// Response that was rate limited.
+	Response *http.Response
+}
+
+func (e *ErrorRateLimited) Error() string {
+	return fmt.Sprintf("hibp: Rate limited from %s %q, retry after %v", e.Response.Request.Method, e.Response.Request.URL.String(), e.RetryAfter)
+}
+
+// newErrorRateLimited returns an ErrorRateLimited for the 429 response.
+func newErrorRateLimited(res *http.Response) *ErrorRateLimited {
+	retryAfter, ok := parseRetryAfter(res.Header.Get("Retry-After"), now())
+	if !ok {
+		retryAfter = DefaultRetryAfter
+	}
+
+	return &ErrorRateLimited{
+		RetryAfter: retryAfter,
+		Response:   res,
+	}
 }
@@ -0,0 +1,51 @@
+package hibp
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+// CheckFailOpen is like Check, but treats the Pwned Passwords API being
+// unavailable as the password not being pwned: transport errors (such as DNS
+// or connection failures), requests exceeding Timeout, 5xx responses and an
+// open circuit breaker return false without an error. Other errors, and all
+// errors once ctx is done, are still returned.
+//
+// This keeps logins and signups working during an outage of the API, at the
+// cost of accepting breached passwords while it lasts. Use it only where that
+// tradeoff is acceptable, and monitor failures such as with OnRequest.
+func (c *PwnedClient) CheckFailOpen(ctx context.Context, password string) (bool, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	pwned, err := c.Check(ctx, password)
+	if err != nil && ctx.Err() == nil && isUnavailable(err) {
+		return false, nil
+	}
+
+	return pwned, err
+}
+
+// isUnavailable reports whether the error means that the Pwned Passwords API
+// could not be reached or failed on its side.
+func isUnavailable(err error) bool {
+	var transport *ErrorTransport
+	var circuitOpen *ErrorCircuitOpen
+	var unexpectedResponse *ErrorUnexpectedResponse
+
+	switch {
+	case errors.As(err, &transport), errors.As(err, &circuitOpen):
+		return true
+
+	case errors.Is(err, context.DeadlineExceeded):
+		// the caller's context is not done, so Timeout was exceeded
+		return true
+
+	case errors.As(err, &unexpectedResponse):
+		return unexpectedResponse.Response.StatusCode >= http.StatusInternalServerError
+	}
+
+	return false
+}
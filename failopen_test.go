@@ -0,0 +1,79 @@
+package hibp
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestCheckFailOpen(t *testing.T) {
+	examples := []struct {
+		statuses []int
+		pwned    bool
+		open     bool
+	}{
+		{[]int{http.StatusOK}, true, false},
+		{[]int{http.StatusServiceUnavailable}, false, true},
+		{[]int{http.StatusBadGateway}, false, true},
+		{[]int{http.StatusNotFound}, false, false},
+		{[]int{http.StatusTooManyRequests}, false, false},
+	}
+
+	for i, example := range examples {
+		calls := 0
+
+		pwnedClient := PwnedClient{
+			HTTP: testStatusSequenceClient(&calls, example.statuses, nil),
+		}
+
+		pwned, err := pwnedClient.CheckFailOpen(context.Background(), "password1")
+		if pwned != example.pwned {
+			t.Errorf("Example %d: unexpected result %v", i, pwned)
+		}
+
+		if example.open && err != nil {
+			t.Errorf("Example %d: expected to fail open, got %v", i, err)
+		} else if !example.open && example.statuses[0] != http.StatusOK && err == nil {
+			t.Errorf("Example %d: expected an error", i)
+		}
+	}
+}
+
+func TestCheckFailOpenTransport(t *testing.T) {
+	pwnedClient := PwnedClient{
+		HTTP: &testHTTPClient{
+			Fn: func(r *http.Request) (*http.Response, error) {
+				return nil, errors.New("connection refused")
+			},
+		},
+	}
+
+	pwned, err := pwnedClient.CheckFailOpen(context.Background(), "password1")
+	if pwned || err != nil {
+		t.Errorf("Unexpected result %v %v", pwned, err)
+	}
+
+	pwnedClient.Timeout = time.Millisecond
+	pwnedClient.HTTP = &testHTTPClient{
+		Fn: func(r *http.Request) (*http.Response, error) {
+			<-r.Context().Done()
+
+			return nil, r.Context().Err()
+		},
+	}
+
+	pwned, err = pwnedClient.CheckFailOpen(context.Background(), "password1")
+	if pwned || err != nil {
+		t.Errorf("Unexpected result %v %v", pwned, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = pwnedClient.CheckFailOpen(ctx, "password1")
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected cancellation to fail, got %v", err)
+	}
+}
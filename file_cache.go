@@ -0,0 +1,297 @@
+package hibp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// FileCache is a PwnedCache persisting the suffixes of each prefix to a file
+// named after the prefix in a directory, so that it survives restarts. Files
+// are replaced atomically, so it is safe for concurrent use, including by
+// multiple processes sharing the directory. Corrupt files are removed and
+// treated as missing.
+type FileCache struct {
+	// TTL, when positive, is how long the suffixes of a prefix are
+	// considered fresh after they were added, based on the modification
+	// time of its file. Expired files are removed. Zero means no expiry.
+	TTL time.Duration
+
+	// MaxPrefixes, when positive, is the maximum number of prefixes kept
+	// in the directory. When exceeded after an Add, the prefixes that were
+	// added the longest ago are removed.
+	MaxPrefixes int
+
+	dir string
+
+	// pruneLock prevents concurrent pruning within a process.
+	pruneLock sync.Mutex
+}
+
+// NewFileCache creates a FileCache storing files in dir, creating it if it
+// does not exist.
+func NewFileCache(dir string) (*FileCache, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+
+	return &FileCache{
+		dir: dir,
+	}, nil
+}
+
+// path returns the path of the file of the prefix, or an empty string if the
+// prefix is not valid, so that it can never escape the directory.
+func (c *FileCache) path(prefix []byte) string {
+	if len(prefix) != prefixLength || !isUpperHex(prefix) {
+		return ""
+	}
+
+	return filepath.Join(c.dir, string(prefix))
+}
+
+// Add records the suffixes of the prefix, replacing any previously recorded
+// for it, one per line.
+func (c *FileCache) Add(ctx context.Context, prefix []byte, suffixes [][]byte) error {
+	path := c.path(prefix)
+	if path == "" {
+		return &ErrorInvalidPrefix{
+			Prefix: string(prefix),
+		}
+	}
+
+	size := 0
+	for _, suffix := range suffixes {
+		size += len(suffix) + 1
+	}
+
+	data := make([]byte, 0, size)
+	for _, suffix := range suffixes {
+		data = append(data, suffix...)
+		data = append(data, '\n')
+	}
+
+	// temporary files start with a dot so they are never taken to be a
+	// prefix, even if left behind by a crash
+	file, err := os.CreateTemp(c.dir, ".tmp-"+string(prefix)+"-*")
+	if err != nil {
+		return err
+	}
+
+	_, err = file.Write(data)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err == nil {
+		err = os.Rename(file.Name(), path)
+	}
+
+	if err != nil {
+		os.Remove(file.Name())
+		return err
+	}
+
+	if c.MaxPrefixes > 0 {
+		return c.prune()
+	}
+
+	return nil
+}
+
+// Contains reports whether the suffix was recorded for the prefix.
+func (c *FileCache) Contains(ctx context.Context, prefix, suffix []byte) (bool, error) {
+	contains, _, err := c.ContainsKnown(ctx, prefix, suffix)
+
+	return contains, err
+}
+
+// ContainsKnown is like Contains, but also reports whether a file for the
+// prefix exists. As Add always records the complete set of suffixes of a
+// prefix, a suffix missing from a known prefix is not pwned.
+func (c *FileCache) ContainsKnown(ctx context.Context, prefix, suffix []byte) (contains, known bool, err error) {
+	path := c.path(prefix)
+	if path == "" {
+		return false, false, nil
+	}
+
+	if c.TTL > 0 {
+		info, err := os.Stat(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			return false, false, nil
+		}
+
+		if err != nil {
+			return false, false, err
+		}
+
+		if now().Sub(info.ModTime()) >= c.TTL {
+			return false, false, removeIfExists(path)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, false, nil
+	}
+
+	if err != nil {
+		return false, false, err
+	}
+
+	lineLength := -1
+
+	for len(data) > 0 {
+		line, rest, found := bytes.Cut(data, []byte{'\n'})
+		data = rest
+
+		if lineLength < 0 {
+			lineLength = len(line)
+		}
+
+		if !found || len(line) != lineLength || len(line) == 0 || !isUpperHex(line) {
+			// the file is corrupt, remove it so it is fetched
+			// and written again
+			return false, false, removeIfExists(path)
+		}
+
+		if bytes.Equal(line, suffix) {
+			contains = true
+		}
+	}
+
+	return contains, true, nil
+}
+
+// Prefixes returns the prefixes with a file in the directory, including
+// expired ones not yet removed. Each file is read to count its suffixes, so it
+// is expensive for large directories.
+func (c *FileCache) Prefixes(ctx context.Context) ([]CachedPrefix, error) {
+	dirEntries, err := os.ReadDir(c.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var prefixes []CachedPrefix
+
+	for _, dirEntry := range dirEntries {
+		name := dirEntry.Name()
+
+		if !dirEntry.Type().IsRegular() || c.path([]byte(name)) == "" {
+			continue
+		}
+
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		info, err := dirEntry.Info()
+		if errors.Is(err, fs.ErrNotExist) {
+			// removed concurrently
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		data, err := os.ReadFile(filepath.Join(c.dir, name))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		prefixes = append(prefixes, CachedPrefix{
+			Prefix:   name,
+			Suffixes: bytes.Count(data, []byte{'\n'}),
+			Added:    info.ModTime(),
+			Expired:  c.TTL > 0 && now().Sub(info.ModTime()) >= c.TTL,
+		})
+	}
+
+	// os.ReadDir returns entries sorted by name
+	return prefixes, nil
+}
+
+// prune removes the files of the prefixes that were added the longest ago
+// until at most MaxPrefixes remain.
+func (c *FileCache) prune() error {
+	c.pruneLock.Lock()
+	defer c.pruneLock.Unlock()
+
+	dirEntries, err := os.ReadDir(c.dir)
+	if err != nil {
+		return err
+	}
+
+	type prefixFile struct {
+		name    string
+		modTime time.Time
+	}
+
+	var files []prefixFile
+
+	for _, dirEntry := range dirEntries {
+		name := dirEntry.Name()
+
+		if !dirEntry.Type().IsRegular() || c.path([]byte(name)) == "" {
+			continue
+		}
+
+		info, err := dirEntry.Info()
+		if err != nil {
+			// removed concurrently
+			continue
+		}
+
+		files = append(files, prefixFile{
+			name:    name,
+			modTime: info.ModTime(),
+		})
+	}
+
+	if len(files) <= c.MaxPrefixes {
+		return nil
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].modTime.Before(files[j].modTime)
+	})
+
+	for _, file := range files[:len(files)-c.MaxPrefixes] {
+		if err := removeIfExists(filepath.Join(c.dir, file.name)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// removeIfExists removes the file at path, ignoring that it may not exist.
+func removeIfExists(path string) error {
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+// isUpperHex reports whether data only contains uppercase hex characters.
+func isUpperHex(data []byte) bool {
+	for _, ch := range data {
+		if (ch < '0' || ch > '9') && (ch < 'A' || ch > 'F') {
+			return false
+		}
+	}
+
+	return true
+}
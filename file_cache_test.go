@@ -0,0 +1,200 @@
+package hibp
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileCache(t *testing.T) {
+	dir := t.TempDir()
+
+	cache, err := NewFileCache(filepath.Join(dir, "cache"))
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	ctx := context.Background()
+
+	if err := cache.Add(ctx, []byte("E38AD"), [][]byte{[]byte("214943DAAD1D64C102FAEC29DE4AFE9DA3D"), []byte("0123456789ABCDEF0123456789ABCDEF012")}); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if err := cache.Add(ctx, []byte("2AA60"), nil); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	// a new instance reads what an earlier one wrote
+	cache, err = NewFileCache(filepath.Join(dir, "cache"))
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	examples := []struct {
+		prefix   string
+		suffix   string
+		contains bool
+		known    bool
+	}{
+		{"E38AD", "214943DAAD1D64C102FAEC29DE4AFE9DA3D", true, true},
+		{"E38AD", "0123456789ABCDEF0123456789ABCDEF012", true, true},
+		{"E38AD", "1123456789ABCDEF0123456789ABCDEF012", false, true},
+		{"2AA60", "A8FF7FCD473D321E0146AFD9E26DF395147", false, true},
+		{"A9993", "E364706816ABA3E25717850C26C9CD0D89D", false, false},
+		{"../..", "E364706816ABA3E25717850C26C9CD0D89D", false, false},
+	}
+
+	for i, example := range examples {
+		contains, known, err := cache.ContainsKnown(ctx, []byte(example.prefix), []byte(example.suffix))
+		if err != nil {
+			t.Errorf("Example %d: unexpected error %v", i, err)
+		}
+
+		if contains != example.contains || known != example.known {
+			t.Errorf("Example %d: unexpected result %v %v", i, contains, known)
+		}
+	}
+
+	if err := cache.Add(ctx, []byte("../.."), nil); err == nil {
+		t.Errorf("Expected an error for an invalid prefix")
+	}
+}
+
+func TestFileCacheCorruptFile(t *testing.T) {
+	dir := t.TempDir()
+
+	cache, err := NewFileCache(dir)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "E38AD"), []byte("214943DAAD1D64C102FAEC29DE4AFE9DA3D\n2149"), 0o600); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	contains, known, err := cache.ContainsKnown(context.Background(), []byte("E38AD"), []byte("214943DAAD1D64C102FAEC29DE4AFE9DA3D"))
+	if err != nil || contains || known {
+		t.Errorf("Unexpected result %v %v %v", contains, known, err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "E38AD")); !os.IsNotExist(err) {
+		t.Errorf("Expected corrupt file to be removed, got %v", err)
+	}
+}
+
+func TestFileCacheMaxPrefixes(t *testing.T) {
+	dir := t.TempDir()
+
+	cache, err := NewFileCache(dir)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	cache.MaxPrefixes = 2
+
+	ctx := context.Background()
+	start := time.Now().Add(-time.Hour)
+
+	for i, prefix := range []string{"00000", "00001", "00002"} {
+		if err := cache.Add(ctx, []byte(prefix), [][]byte{[]byte("214943DAAD1D64C102FAEC29DE4AFE9DA3D")}); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+
+		// modification times may be too coarse to tell files apart
+		modTime := start.Add(time.Duration(i) * time.Minute)
+		if err := os.Chtimes(filepath.Join(dir, prefix), modTime, modTime); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+	}
+
+	dirEntries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if len(dirEntries) != 2 || dirEntries[0].Name() != "00001" || dirEntries[1].Name() != "00002" {
+		t.Errorf("Unexpected files after pruning %v", dirEntries)
+	}
+}
+
+func TestFileCacheTTL(t *testing.T) {
+	dir := t.TempDir()
+
+	cache, err := NewFileCache(dir)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	cache.TTL = time.Minute
+
+	ctx := context.Background()
+
+	if err := cache.Add(ctx, []byte("E38AD"), [][]byte{[]byte("214943DAAD1D64C102FAEC29DE4AFE9DA3D")}); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if contains, _ := cache.Contains(ctx, []byte("E38AD"), []byte("214943DAAD1D64C102FAEC29DE4AFE9DA3D")); !contains {
+		t.Errorf("Expected fresh prefix to be contained")
+	}
+
+	expired := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(filepath.Join(dir, "E38AD"), expired, expired); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if contains, _ := cache.Contains(ctx, []byte("E38AD"), []byte("214943DAAD1D64C102FAEC29DE4AFE9DA3D")); contains {
+		t.Errorf("Expected expired prefix not to be contained")
+	}
+}
+
+func TestFileCachePrefixes(t *testing.T) {
+	dir := t.TempDir()
+
+	cache, err := NewFileCache(dir)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	cache.TTL = time.Minute
+
+	var _ CacheInspector = cache
+
+	ctx := context.Background()
+
+	if err := cache.Add(ctx, []byte("E38AD"), [][]byte{[]byte("214943DAAD1D64C102FAEC29DE4AFE9DA3D"), []byte("0123456789ABCDEF0123456789ABCDEF012")}); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if err := cache.Add(ctx, []byte("2AA60"), nil); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	expired := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(filepath.Join(dir, "2AA60"), expired, expired); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	// files that are not prefixes are ignored
+	if err := os.WriteFile(filepath.Join(dir, ".tmp-A9993-1"), []byte("E364706816ABA3E25717850C26C9CD0D89D\n"), 0o600); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	prefixes, err := cache.Prefixes(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if len(prefixes) != 2 {
+		t.Fatalf("Unexpected prefixes %v", prefixes)
+	}
+
+	if prefixes[0].Prefix != "2AA60" || prefixes[0].Suffixes != 0 || !prefixes[0].Expired {
+		t.Errorf("Unexpected prefix %v", prefixes[0])
+	}
+
+	if prefixes[1].Prefix != "E38AD" || prefixes[1].Suffixes != 2 || prefixes[1].Expired {
+		t.Errorf("Unexpected prefix %v", prefixes[1])
+	}
+}
@@ -0,0 +1,45 @@
+package hibp
+
+import (
+	"time"
+)
+
+// logRedacted is included in every log line, noting that suffixes and
+// passwords are left out of the logs on purpose.
+const logRedacted = "suffix and password redacted"
+
+// logCache logs whether the Cache answered for the prefix.
+func (c *PwnedClient) logCache(prefix []byte, hit bool) {
+	if c.Logf == nil {
+		return
+	}
+
+	decision := "miss, fetching range"
+	if hit {
+		decision = "hit, answered without a request"
+	}
+
+	c.Logf("hibp: prefix %s (%s): cache %s", prefix, logRedacted, decision)
+}
+
+// logRequest logs the outcome of a request attempt for the prefix.
+func (c *PwnedClient) logRequest(prefix []byte, attempt, status int, err error) {
+	if c.Logf == nil {
+		return
+	}
+
+	if err != nil {
+		c.Logf("hibp: prefix %s (%s): request attempt %d failed: %v", prefix, logRedacted, attempt, err)
+	} else {
+		c.Logf("hibp: prefix %s (%s): request attempt %d returned status %d", prefix, logRedacted, attempt, status)
+	}
+}
+
+// logRetry logs that a request for the prefix is retried after a delay.
+func (c *PwnedClient) logRetry(prefix []byte, attempt int, delay time.Duration) {
+	if c.Logf == nil {
+		return
+	}
+
+	c.Logf("hibp: prefix %s (%s): retrying in %v, attempt %d", prefix, logRedacted, delay, attempt+1)
+}
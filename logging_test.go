@@ -0,0 +1,70 @@
+package hibp
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLogf(t *testing.T) {
+	calls := 0
+
+	var logs []string
+
+	pwnedClient := PwnedClient{
+		Cache:      NewLRUCache(10),
+		MaxRetries: 1,
+		Backoff:    testBackoff(time.Millisecond),
+		HTTP:       testStatusSequenceClient(&calls, []int{http.StatusServiceUnavailable, http.StatusOK}, nil),
+		Logf: func(format string, args ...any) {
+			logs = append(logs, fmt.Sprintf(format, args...))
+		},
+	}
+
+	for i := 0; i < 2; i += 1 {
+		if _, err := pwnedClient.Check(context.Background(), "password1"); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+	}
+
+	expected := []string{
+		"cache miss",
+		"request attempt 1 returned status 503",
+		"retrying in 1ms, attempt 2",
+		"request attempt 2 returned status 200",
+		"cache hit",
+	}
+
+	if len(logs) != len(expected) {
+		t.Fatalf("Unexpected logs %q", logs)
+	}
+
+	for i, log := range logs {
+		if !strings.HasPrefix(log, "hibp: prefix E38AD ("+logRedacted+"): ") || !strings.Contains(log, expected[i]) {
+			t.Errorf("Unexpected log %q", log)
+		}
+
+		if strings.Contains(log, "password1") || strings.Contains(log, "214943DAAD1D64C102FAEC29DE4AFE9DA3D") {
+			t.Errorf("Log %q leaks the password or suffix", log)
+		}
+	}
+}
+
+func TestLogfNil(t *testing.T) {
+	pwnedClient := PwnedClient{}
+
+	prefix := []byte("E38AD")
+
+	allocs := testing.AllocsPerRun(10, func() {
+		pwnedClient.logCache(prefix, true)
+		pwnedClient.logRequest(prefix, 1, http.StatusOK, nil)
+		pwnedClient.logRetry(prefix, 1, time.Second)
+	})
+
+	if allocs != 0 {
+		t.Errorf("Expected no allocations without Logf, got %v", allocs)
+	}
+}
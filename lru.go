@@ -0,0 +1,280 @@
+package hibp
+
+import (
+	"container/list"
+	"context"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// LRUCache is an in-memory PwnedCache holding the suffixes of at most a fixed
+// number of prefixes. When full, the least recently used prefix is evicted.
+// It is safe for concurrent use.
+type LRUCache struct {
+	// TTL, when positive, is how long the suffixes of a prefix are
+	// considered fresh after they were added. Expired prefixes are treated
+	// as missing, so they are fetched again. Zero means no expiry. Set it
+	// before the cache is used.
+	TTL time.Duration
+
+	maxPrefixes int
+
+	lock    sync.Mutex
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+// lruEntry is the value of the elements in LRUCache.order.
+type lruEntry struct {
+	prefix string
+
+	// suffixes are sorted
+	suffixes []string
+
+	// counts holds the occurrence count of each of the suffixes, or is
+	// nil if they were added without counts.
+	counts []int
+
+	// added is when the suffixes were added, or last refreshed
+	added time.Time
+
+	// etag is the ETag of the response the suffixes came from, if any.
+	etag string
+}
+
+func (e *lruEntry) Len() int {
+	return len(e.suffixes)
+}
+
+func (e *lruEntry) Less(i, j int) bool {
+	return e.suffixes[i] < e.suffixes[j]
+}
+
+func (e *lruEntry) Swap(i, j int) {
+	e.suffixes[i], e.suffixes[j] = e.suffixes[j], e.suffixes[i]
+
+	if e.counts != nil {
+		e.counts[i], e.counts[j] = e.counts[j], e.counts[i]
+	}
+}
+
+// NewLRUCache creates an LRUCache holding at most maxPrefixes prefixes. At
+// least one prefix is always held.
+func NewLRUCache(maxPrefixes int) *LRUCache {
+	return &LRUCache{
+		maxPrefixes: max(maxPrefixes, 1),
+		order:       list.New(),
+		entries:     make(map[string]*list.Element),
+	}
+}
+
+// Add records the suffixes of the prefix, replacing any previously recorded
+// for it, and evicts the least recently used prefix if the cache is full.
+func (c *LRUCache) Add(ctx context.Context, prefix []byte, suffixes [][]byte) error {
+	return c.AddCounts(ctx, prefix, suffixes, nil)
+}
+
+// AddCounts is like Add, but also records the occurrence count of each suffix
+// so that Count can answer for the prefix.
+func (c *LRUCache) AddCounts(ctx context.Context, prefix []byte, suffixes, counts [][]byte) error {
+	return c.AddETag(ctx, prefix, suffixes, counts, "")
+}
+
+// AddETag is like AddCounts, but also records the ETag of the response the
+// suffixes came from. Expired prefixes with an ETag are kept until evicted, so
+// that they can be revalidated.
+func (c *LRUCache) AddETag(ctx context.Context, prefix []byte, suffixes, counts [][]byte, etag string) error {
+	entry := &lruEntry{
+		prefix:   string(prefix),
+		suffixes: make([]string, len(suffixes)),
+		added:    now(),
+		etag:     etag,
+	}
+
+	for i, suffix := range suffixes {
+		entry.suffixes[i] = string(suffix)
+	}
+
+	if counts != nil {
+		entry.counts = make([]int, len(counts))
+
+		for i, count := range counts {
+			entry.counts[i] = parseCount(count)
+		}
+	}
+
+	sort.Sort(entry)
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if element, ok := c.entries[entry.prefix]; ok {
+		element.Value = entry
+		c.order.MoveToFront(element)
+
+		return nil
+	}
+
+	c.entries[entry.prefix] = c.order.PushFront(entry)
+
+	for c.order.Len() > c.maxPrefixes {
+		oldest := c.order.Back()
+
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*lruEntry).prefix)
+	}
+
+	return nil
+}
+
+// Contains reports whether the suffix was recorded for the prefix, marking
+// the prefix as recently used. Expired prefixes are removed.
+func (c *LRUCache) Contains(ctx context.Context, prefix, suffix []byte) (bool, error) {
+	contains, _, err := c.ContainsKnown(ctx, prefix, suffix)
+
+	return contains, err
+}
+
+// ContainsKnown is like Contains, but also reports whether the prefix is in
+// the cache. As Add always records the complete set of suffixes of a prefix,
+// a suffix missing from a known prefix is not pwned.
+func (c *LRUCache) ContainsKnown(ctx context.Context, prefix, suffix []byte) (contains, known bool, err error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	entry, _, contains := c.find(prefix, suffix)
+
+	return contains, entry != nil, nil
+}
+
+// Count returns the occurrence count of the suffix recorded with AddCounts,
+// or 0 if it is absent. The returned ok is false if the prefix is not in the
+// cache or was added without counts.
+func (c *LRUCache) Count(ctx context.Context, prefix, suffix []byte) (count int, ok bool, err error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	entry, index, contains := c.find(prefix, suffix)
+
+	switch {
+	case entry == nil:
+		return 0, false, nil
+
+	case !contains:
+		return 0, true, nil
+
+	case entry.counts == nil:
+		return 0, false, nil
+	}
+
+	return entry.counts[index], true, nil
+}
+
+// Stale returns copies of the suffixes and counts of the prefix along with
+// their ETag, even if they have expired. The ETag is empty if the prefix is
+// missing or was added without counts.
+func (c *LRUCache) Stale(ctx context.Context, prefix []byte) (suffixes, counts [][]byte, etag string, err error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	element, ok := c.entries[string(prefix)]
+	if !ok {
+		return nil, nil, "", nil
+	}
+
+	entry := element.Value.(*lruEntry)
+
+	if entry.etag == "" || entry.counts == nil {
+		return nil, nil, "", nil
+	}
+
+	suffixes = make([][]byte, len(entry.suffixes))
+	counts = make([][]byte, len(entry.counts))
+
+	for i, suffix := range entry.suffixes {
+		suffixes[i] = []byte(suffix)
+		counts[i] = strconv.AppendInt(nil, int64(entry.counts[i]), 10)
+	}
+
+	return suffixes, counts, entry.etag, nil
+}
+
+// Refresh marks the suffixes of the prefix as freshly added and recently used.
+func (c *LRUCache) Refresh(ctx context.Context, prefix []byte) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if element, ok := c.entries[string(prefix)]; ok {
+		element.Value.(*lruEntry).added = now()
+		c.order.MoveToFront(element)
+	}
+
+	return nil
+}
+
+// Prefixes returns the prefixes in the cache, including expired ones not yet
+// removed. It does not mark them as recently used.
+func (c *LRUCache) Prefixes(ctx context.Context) ([]CachedPrefix, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	prefixes := make([]CachedPrefix, 0, c.order.Len())
+
+	for element := c.order.Front(); element != nil; element = element.Next() {
+		entry := element.Value.(*lruEntry)
+
+		prefixes = append(prefixes, CachedPrefix{
+			Prefix:   entry.prefix,
+			Suffixes: len(entry.suffixes),
+			Added:    entry.added,
+			Expired:  c.TTL > 0 && now().Sub(entry.added) >= c.TTL,
+		})
+	}
+
+	sort.Slice(prefixes, func(i, j int) bool {
+		return prefixes[i].Prefix < prefixes[j].Prefix
+	})
+
+	return prefixes, nil
+}
+
+// find returns the entry of the prefix, or nil if it is missing or expired, and
+// the index of the suffix in it. It marks the prefix as recently used and
+// removes it if expired. The lock must be held.
+func (c *LRUCache) find(prefix, suffix []byte) (entry *lruEntry, index int, contains bool) {
+	element, ok := c.entries[string(prefix)]
+	if !ok {
+		return nil, 0, false
+	}
+
+	entry = element.Value.(*lruEntry)
+
+	if c.TTL > 0 && now().Sub(entry.added) >= c.TTL {
+		// entries with an ETag are kept so that they can be
+		// revalidated
+		if entry.etag == "" {
+			c.order.Remove(element)
+			delete(c.entries, entry.prefix)
+		}
+
+		return nil, 0, false
+	}
+
+	c.order.MoveToFront(element)
+
+	suffixes := entry.suffixes
+
+	index = sort.SearchStrings(suffixes, string(suffix))
+
+	return entry, index, index < len(suffixes) && suffixes[index] == string(suffix)
+}
+
+// Len returns the number of prefixes in the cache.
+func (c *LRUCache) Len() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.order.Len()
+}
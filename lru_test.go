@@ -0,0 +1,370 @@
+package hibp
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLRUCache(t *testing.T) {
+	ctx := context.Background()
+	cache := NewLRUCache(2)
+
+	suffix := []byte("0123456789ABCDEF0123456789ABCDEF012")
+	other := []byte("1123456789ABCDEF0123456789ABCDEF012")
+
+	cache.Add(ctx, []byte("00000"), [][]byte{other, suffix})
+	cache.Add(ctx, []byte("11111"), [][]byte{suffix})
+
+	if contains, _ := cache.Contains(ctx, []byte("11111"), other); contains {
+		t.Errorf("Found suffix that was not added")
+	}
+
+	if contains, _ := cache.Contains(ctx, []byte("00000"), suffix); !contains {
+		t.Errorf("Expected suffix to be found")
+	}
+
+	// 00000 was used more recently than 11111, so 11111 is evicted
+	cache.Add(ctx, []byte("22222"), [][]byte{suffix})
+
+	if cache.Len() != 2 {
+		t.Errorf("Unexpected length %d", cache.Len())
+	}
+
+	if contains, _ := cache.Contains(ctx, []byte("11111"), suffix); contains {
+		t.Errorf("Expected prefix 11111 to be evicted")
+	}
+
+	for _, prefix := range []string{"00000", "22222"} {
+		if contains, _ := cache.Contains(ctx, []byte(prefix), suffix); !contains {
+			t.Errorf("Expected prefix %q to survive", prefix)
+		}
+	}
+
+	// replacing an existing prefix does not evict anything
+	cache.Add(ctx, []byte("00000"), [][]byte{other})
+
+	if contains, _ := cache.Contains(ctx, []byte("00000"), suffix); contains {
+		t.Errorf("Expected suffixes to be replaced")
+	}
+
+	if contains, _ := cache.Contains(ctx, []byte("22222"), suffix); !contains {
+		t.Errorf("Expected prefix 22222 to survive")
+	}
+}
+
+func TestLRUCacheCopiesSuffixes(t *testing.T) {
+	ctx := context.Background()
+	cache := NewLRUCache(0)
+
+	suffix := []byte("0123456789ABCDEF0123456789ABCDEF012")
+	cache.Add(ctx, []byte("00000"), [][]byte{suffix})
+
+	// buffers passed to Add are reused by PwnedClient
+	suffix[0] = 'F'
+
+	if contains, _ := cache.Contains(ctx, []byte("00000"), []byte("0123456789ABCDEF0123456789ABCDEF012")); !contains {
+		t.Errorf("Expected suffix to be copied")
+	}
+}
+
+func TestLRUCacheConcurrent(t *testing.T) {
+	ctx := context.Background()
+	cache := NewLRUCache(4)
+
+	wg := &sync.WaitGroup{}
+
+	for i := 0; i < 8; i += 1 {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			prefix := []byte{'0' + byte(i), '0', '0', '0', '0'}
+
+			for j := 0; j < 100; j += 1 {
+				cache.Add(ctx, prefix, [][]byte{[]byte("0123456789ABCDEF0123456789ABCDEF012")})
+				cache.Contains(ctx, prefix, []byte("0123456789ABCDEF0123456789ABCDEF012"))
+			}
+		}(i)
+	}
+
+	wg.Wait()
+
+	if cache.Len() != 4 {
+		t.Errorf("Unexpected length %d", cache.Len())
+	}
+}
+
+func TestLRUCacheWithClient(t *testing.T) {
+	calls := 0
+
+	pwnedClient := PwnedClient{
+		Cache: NewLRUCache(10),
+		HTTP:  testStatusSequenceClient(&calls, []int{200}, nil),
+	}
+
+	for i := 0; i < 2; i += 1 {
+		res, err := pwnedClient.Check(context.Background(), "password1")
+		if err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+
+		if !res {
+			t.Errorf("Expected result to be true, but was false")
+		}
+	}
+
+	if calls != 1 {
+		t.Errorf("Expected a single HTTP call, got %d", calls)
+	}
+}
+
+func TestLRUCacheTTL(t *testing.T) {
+	clock := useFakeClock(t)
+
+	ctx := context.Background()
+	suffix := []byte("0123456789ABCDEF0123456789ABCDEF012")
+
+	cache := NewLRUCache(2)
+	cache.TTL = time.Hour
+
+	cache.Add(ctx, []byte("00000"), [][]byte{suffix})
+
+	if contains, _ := cache.Contains(ctx, []byte("00000"), suffix); !contains {
+		t.Errorf("Expected suffix to be found before expiry")
+	}
+
+	clock.Advance(time.Hour - time.Nanosecond)
+
+	if contains, _ := cache.Contains(ctx, []byte("00000"), suffix); !contains {
+		t.Errorf("Expected suffix to be found right before expiry")
+	}
+
+	clock.Advance(time.Nanosecond)
+
+	if contains, _ := cache.Contains(ctx, []byte("00000"), suffix); contains {
+		t.Errorf("Expected suffix to be expired")
+	}
+
+	if cache.Len() != 0 {
+		t.Errorf("Expected expired prefix to be removed")
+	}
+
+	cache.TTL = 0
+	cache.Add(ctx, []byte("00000"), [][]byte{suffix})
+
+	clock.Advance(24 * time.Hour)
+
+	if contains, _ := cache.Contains(ctx, []byte("00000"), suffix); !contains {
+		t.Errorf("Expected suffix to never expire with zero TTL")
+	}
+}
+
+func TestLRUCacheNegativeResults(t *testing.T) {
+	calls := 0
+
+	pwnedClient := PwnedClient{
+		Cache: NewLRUCache(10),
+		HTTP:  testStatusSequenceClient(&calls, []int{200}, nil),
+	}
+
+	// repeated checks of a known prefix are answered from the cache,
+	// whether or not the suffix is pwned
+	for _, password := range []string{"not pwned", "not pwned", "password1", "password1"} {
+		_, err := pwnedClient.Check(context.Background(), password)
+		if err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+	}
+
+	if calls != 2 {
+		t.Errorf("Expected 2 HTTP calls, got %d", calls)
+	}
+
+	res, err := pwnedClient.CheckHash(context.Background(), "E38AD00000000000000000000000000000000000")
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	if res {
+		t.Errorf("Expected result to be false, but was true")
+	}
+
+	if calls != 2 {
+		t.Errorf("Expected absent suffix of a known prefix to be answered from the cache")
+	}
+}
+
+func TestLRUCacheCounts(t *testing.T) {
+	ctx := context.Background()
+	cache := NewLRUCache(2)
+
+	suffix := []byte("0123456789ABCDEF0123456789ABCDEF012")
+	other := []byte("1123456789ABCDEF0123456789ABCDEF012")
+	missing := []byte("2123456789ABCDEF0123456789ABCDEF012")
+
+	cache.AddCounts(ctx, []byte("00000"), [][]byte{other, suffix}, [][]byte{[]byte("7"), []byte("3")})
+	cache.Add(ctx, []byte("11111"), [][]byte{suffix})
+
+	examples := []struct {
+		Prefix string
+		Suffix []byte
+		Count  int
+		OK     bool
+	}{
+		{"00000", suffix, 3, true},
+		{"00000", other, 7, true},
+		{"00000", missing, 0, true},
+		{"11111", suffix, 0, false},
+		{"11111", missing, 0, true},
+		{"22222", suffix, 0, false},
+	}
+
+	for _, example := range examples {
+		count, ok, err := cache.Count(ctx, []byte(example.Prefix), example.Suffix)
+		if err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+
+		if count != example.Count || ok != example.OK {
+			t.Errorf("Unexpected count for %s%s %d %v", example.Prefix, example.Suffix, count, ok)
+		}
+	}
+}
+
+func TestLRUCacheCountsWithClient(t *testing.T) {
+	calls := 0
+
+	pwnedClient := PwnedClient{
+		Cache: NewLRUCache(10),
+		HTTP:  testStatusSequenceClient(&calls, []int{200}, nil),
+	}
+
+	for i := 0; i < 2; i += 1 {
+		count, err := pwnedClient.CheckCount(context.Background(), "password1")
+		if err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+
+		if count != 1 {
+			t.Errorf("Unexpected count %d", count)
+		}
+	}
+
+	result, err := pwnedClient.Lookup(context.Background(), "password1")
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	if !result.FromCache || result.Count != 1 {
+		t.Errorf("Expected count from the cache, got %+v", result)
+	}
+
+	if calls != 1 {
+		t.Errorf("Expected a single HTTP call, got %d", calls)
+	}
+}
+
+func TestLRUCacheRevalidation(t *testing.T) {
+	clock := useFakeClock(t)
+
+	var requests []string
+
+	cache := NewLRUCache(10)
+	cache.TTL = time.Hour
+
+	pwnedClient := PwnedClient{
+		Cache: cache,
+		HTTP: &testHTTPClient{
+			Fn: func(r *http.Request) (*http.Response, error) {
+				ifNoneMatch := r.Header.Get("If-None-Match")
+				requests = append(requests, ifNoneMatch)
+
+				if ifNoneMatch == `"v1"` {
+					// the body is ignored, so make sure it is
+					// not parsed
+					return &http.Response{
+						StatusCode: http.StatusNotModified,
+						Status:     "304 Not Modified",
+						Header:     http.Header{"Etag": []string{`"v1"`}},
+						Body:       io.NopCloser(strings.NewReader("invalid\n")),
+						Request:    r,
+					}, nil
+				}
+
+				return &http.Response{
+					StatusCode: http.StatusOK,
+					Header:     http.Header{"Etag": []string{`"v1"`}},
+					Body:       io.NopCloser(strings.NewReader("214943DAAD1D64C102FAEC29DE4AFE9DA3D:7\r\n")),
+					Request:    r,
+				}, nil
+			},
+		},
+	}
+
+	lookup := func() Result {
+		result, err := pwnedClient.Lookup(context.Background(), "password1")
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+
+		return result
+	}
+
+	if result := lookup(); result.Count != 7 || result.ETag != `"v1"` || result.FromCache {
+		t.Errorf("Unexpected result %+v", result)
+	}
+
+	clock.Advance(time.Hour)
+
+	// expired, revalidated with a 304 reusing the cached suffixes
+	if result := lookup(); result.Count != 7 || result.ETag != `"v1"` || result.FromCache {
+		t.Errorf("Unexpected result %+v", result)
+	}
+
+	// fresh again after the revalidation
+	if result := lookup(); result.Count != 7 || !result.FromCache {
+		t.Errorf("Unexpected result %+v", result)
+	}
+
+	if !reflect.DeepEqual(requests, []string{"", `"v1"`}) {
+		t.Errorf("Unexpected requests %q", requests)
+	}
+}
+
+func TestLRUCachePrefixes(t *testing.T) {
+	clock := useFakeClock(t)
+
+	ctx := context.Background()
+	suffix := []byte("0123456789ABCDEF0123456789ABCDEF012")
+
+	cache := NewLRUCache(3)
+	cache.TTL = time.Hour
+
+	var _ CacheInspector = cache
+
+	cache.Add(ctx, []byte("E38AD"), [][]byte{suffix})
+
+	clock.Advance(time.Hour)
+
+	cache.Add(ctx, []byte("00000"), [][]byte{suffix, []byte("1123456789ABCDEF0123456789ABCDEF012")})
+
+	prefixes, err := cache.Prefixes(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	expected := []CachedPrefix{
+		{Prefix: "00000", Suffixes: 2, Added: clock.Now()},
+		{Prefix: "E38AD", Suffixes: 1, Added: clock.Now().Add(-time.Hour), Expired: true},
+	}
+
+	if !reflect.DeepEqual(prefixes, expected) {
+		t.Errorf("Unexpected prefixes %v", prefixes)
+	}
+}
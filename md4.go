@@ -0,0 +1,102 @@
+package hibp
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+// md4Size is the size of an MD4 digest in bytes.
+const md4Size = 16
+
+// md4Sum returns the MD4 digest of the data per RFC 1320. MD4 is broken and
+// only implemented here as it is required to compute NTLM hashes, which is
+// not offered by the standard library. As the data is a password, it is never
+// copied to the heap, and copies on the stack are wiped.
+func md4Sum(data []byte) [md4Size]byte {
+	length := uint64(len(data)) * 8
+
+	state := [4]uint32{0x67452301, 0xefcdab89, 0x98badcfe, 0x10325476}
+
+	full := len(data) &^ 63
+
+	for block := data[:full]; len(block) > 0; block = block[64:] {
+		md4Block(&state, block)
+	}
+
+	// only the remaining data is copied to be padded, into one or two
+	// blocks depending on whether the length still fits after it
+	var tail [128]byte
+
+	n := copy(tail[:], data[full:])
+	tail[n] = 0x80
+
+	size := 64
+	if n >= 56 {
+		size = 128
+	}
+
+	binary.LittleEndian.PutUint64(tail[size-8:], length)
+
+	for block := tail[:size]; len(block) > 0; block = block[64:] {
+		md4Block(&state, block)
+	}
+
+	clear(tail[:])
+
+	var sum [md4Size]byte
+
+	for i, word := range state {
+		binary.LittleEndian.PutUint32(sum[i*4:], word)
+	}
+
+	return sum
+}
+
+// md4Block updates the state with a single 64 byte block, wiping its copy of
+// the block afterwards.
+func md4Block(state *[4]uint32, block []byte) {
+	a, b, c, d := state[0], state[1], state[2], state[3]
+
+	var x [16]uint32
+
+	for i := range x {
+		x[i] = binary.LittleEndian.Uint32(block[i*4:])
+	}
+
+	// each step computes a new value for a, after which the
+	// variables are rotated so the next step computes d, c, b...
+
+	for i := 0; i < 16; i += 1 {
+		f := (b & c) | (^b & d)
+		t := bits.RotateLeft32(a+f+x[i], md4Round1Shifts[i%4])
+		a, b, c, d = d, t, b, c
+	}
+
+	for i := 0; i < 16; i += 1 {
+		g := (b & c) | (b & d) | (c & d)
+		t := bits.RotateLeft32(a+g+x[md4Round2Order[i]]+0x5a827999, md4Round2Shifts[i%4])
+		a, b, c, d = d, t, b, c
+	}
+
+	for i := 0; i < 16; i += 1 {
+		h := b ^ c ^ d
+		t := bits.RotateLeft32(a+h+x[md4Round3Order[i]]+0x6ed9eba1, md4Round3Shifts[i%4])
+		a, b, c, d = d, t, b, c
+	}
+
+	state[0] += a
+	state[1] += b
+	state[2] += c
+	state[3] += d
+
+	clear(x[:])
+}
+
+var (
+	md4Round1Shifts = [4]int{3, 7, 11, 19}
+	md4Round2Shifts = [4]int{3, 5, 9, 13}
+	md4Round3Shifts = [4]int{3, 9, 11, 15}
+
+	md4Round2Order = [16]int{0, 4, 8, 12, 1, 5, 9, 13, 2, 6, 10, 14, 3, 7, 11, 15}
+	md4Round3Order = [16]int{0, 8, 4, 12, 2, 10, 6, 14, 1, 9, 5, 13, 3, 11, 7, 15}
+)
@@ -0,0 +1,42 @@
+package hibp
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestMD4(t *testing.T) {
+	// test vectors from RFC 1320
+	examples := map[string]string{
+		"":                           "31d6cfe0d16ae931b73c59d7e0c089c0",
+		"a":                          "bde52cb31de33e46245e05fbdbd6fb24",
+		"abc":                        "a448017aaf21d8525fc10ae87aa6729d",
+		"message digest":             "d9130a8164549fe818874806e1c7014b",
+		"abcdefghijklmnopqrstuvwxyz": "d79e1c308aa5bbcdeea8ed63df412da9",
+		"ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789":                   "043f8582f241db351ce627e153e7f0e4",
+		"12345678901234567890123456789012345678901234567890123456789012345678901234567890": "e33b4ddc9c38f2199c3e7b164fcc0536",
+	}
+
+	for data, expected := range examples {
+		sum := md4Sum([]byte(data))
+
+		if hex.EncodeToString(sum[:]) != expected {
+			t.Errorf("Unexpected MD4 for %q %x expected %s", data, sum, expected)
+		}
+	}
+}
+
+func TestMD4NoCopies(t *testing.T) {
+	data := []byte(strings.Repeat("p\x00", 100))
+
+	// copying the data to pad it would allocate, as its size is only
+	// known at run time, and leave the copy behind on the heap
+	allocs := testing.AllocsPerRun(10, func() {
+		md4Sum(data)
+	})
+
+	if allocs != 0 {
+		t.Errorf("Expected no allocations, got %v", allocs)
+	}
+}
@@ -0,0 +1,37 @@
+//go:build unix
+
+package hibp
+
+import (
+	"os"
+	"syscall"
+)
+
+// mapFile memory-maps the file at path read-only.
+func mapFile(path string) ([]byte, func() error, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if info.Size() == 0 {
+		// mmap does not support empty mappings
+		return nil, func() error { return nil }, nil
+	}
+
+	data, err := syscall.Mmap(int(file.Fd()), 0, int(info.Size()), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return data, func() error {
+		return syscall.Munmap(data)
+	}, nil
+}
@@ -0,0 +1,159 @@
+package hibp
+
+import (
+	"crypto/sha1"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Mode selects the hash function used with the Pwned Passwords API.
+type Mode int
+
+const (
+	// ModeSHA1 checks SHA-1 hashes of passwords. This is the default.
+	ModeSHA1 Mode = iota
+
+	// ModeNTLM checks NTLM hashes of passwords, which is the MD4 of the
+	// UTF-16LE encoded password as used by Active Directory.
+	ModeNTLM
+)
+
+// String returns the name of the mode as used by the Pwned Passwords API.
+func (m Mode) String() string {
+	if m == ModeNTLM {
+		return "ntlm"
+	}
+
+	return "sha1"
+}
+
+// hashLength returns the length of the hex encoded hash.
+func (m Mode) hashLength() int {
+	if m == ModeNTLM {
+		return 2 * md4Size
+	}
+
+	return 2 * sha1.Size
+}
+
+// linePattern returns the pattern for parsing response lines, which differ
+// only in the length of the suffix.
+func (m Mode) linePattern() *regexp.Regexp {
+	if m == ModeNTLM {
+		return pwnedNTLMLinePattern
+	}
+
+	return pwnedLinePattern
+}
+
+// url returns the range URL for the prefix under baseURL, which must end in a
+// slash.
+func (m Mode) url(baseURL, prefix string) string {
+	if m == ModeNTLM {
+		return baseURL + prefix + "?mode=ntlm"
+	}
+
+	return baseURL + prefix
+}
+
+// hash computes the uppercase hex hash of the password and splits it into the
+// prefix and suffix.
+func (m Mode) hash(password string) (prefix, suffix []byte) {
+	if m == ModeNTLM {
+		return hashPasswordNTLM(password)
+	}
+
+	return hashPassword(password)
+}
+
+// hashBytes is like hash, but for a password held in a byte slice. No copies
+// of the password outlive the call.
+func (m Mode) hashBytes(password []byte) (prefix, suffix []byte) {
+	if m == ModeNTLM {
+		return hashPasswordNTLMBytes(password)
+	}
+
+	return hashPasswordBytes(password)
+}
+
+// splitHash validates that hash is a hex hash of the expected length and
+// splits it into the uppercase prefix and suffix.
+func (m Mode) splitHash(hash string) (prefix, suffix []byte, err error) {
+	if len(hash) != m.hashLength() {
+		return nil, nil, &ErrorInvalidHash{
+			Hash:   hash,
+			Length: m.hashLength(),
+		}
+	}
+
+	normalized := []byte(strings.ToUpper(hash))
+
+	for _, ch := range normalized {
+		if (ch < '0' || ch > '9') && (ch < 'A' || ch > 'F') {
+			return nil, nil, &ErrorInvalidHash{
+				Hash:   hash,
+				Length: m.hashLength(),
+			}
+		}
+	}
+
+	return normalized[:prefixLength], normalized[prefixLength:], nil
+}
+
+// hashPasswordNTLM computes the uppercase hex NTLM hash of the password and
+// splits it into the 5 character prefix and 27 character suffix.
+func hashPasswordNTLM(password string) (prefix, suffix []byte) {
+	data := make([]byte, 0, 2*len(password))
+	for _, r := range password {
+		data = appendUTF16LE(data, r)
+	}
+
+	return hashNTLMData(data)
+}
+
+// hashPasswordNTLMBytes is like hashPasswordNTLM, but for a password held in a
+// byte slice.
+func hashPasswordNTLMBytes(password []byte) (prefix, suffix []byte) {
+	// UTF-16 never takes more than twice the bytes of UTF-8, so data is
+	// never reallocated, which would leave a copy behind that is not wiped
+	data := make([]byte, 0, 2*len(password))
+	for len(password) > 0 {
+		r, size := utf8.DecodeRune(password)
+		password = password[size:]
+
+		data = appendUTF16LE(data, r)
+	}
+
+	return hashNTLMData(data)
+}
+
+// appendUTF16LE appends the UTF-16LE encoding of the rune to data.
+func appendUTF16LE(data []byte, r rune) []byte {
+	if r1, r2 := utf16.EncodeRune(r); r1 != utf8.RuneError || r2 != utf8.RuneError {
+		return append(data, byte(r1), byte(r1>>8), byte(r2), byte(r2>>8))
+	}
+
+	if r > unicode.MaxRune || utf16.IsSurrogate(r) {
+		r = utf8.RuneError
+	}
+
+	return append(data, byte(r), byte(r>>8))
+}
+
+// hashNTLMData computes the NTLM hash of the UTF-16LE encoded password in data,
+// wiping data afterwards, and splits it into the prefix and suffix.
+func hashNTLMData(data []byte) (prefix, suffix []byte) {
+	sum := md4Sum(data)
+	clear(data)
+
+	hexsum := appendUpperHex(make([]byte, 0, 2*md4Size), sum[:])
+
+	return hexsum[:prefixLength], hexsum[prefixLength:]
+}
+
+// pwnedNTLMLinePattern is like pwnedLinePattern, but for the 27 character
+// suffixes of NTLM hashes.
+var pwnedNTLMLinePattern = regexp.MustCompile(`^([0-9A-Fa-f]{27}):([0-9]+)$`)
@@ -0,0 +1,229 @@
+package hibp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+	"unicode/utf16"
+)
+
+func TestHashPasswordNTLM(t *testing.T) {
+	examples := map[string]string{
+		"":         "31D6CFE0D16AE931B73C59D7E0C089C0",
+		"password": "8846F7EAEE8FB117AD06BDD830B7586C",
+		"Password": "A4F49C406510BDCAB6824EE7C30FD852",
+		"123456":   "32ED87BDB5FDC5E9CBA88547376818D4",
+	}
+
+	for password, expected := range examples {
+		prefix, suffix := ModeNTLM.hash(password)
+
+		if string(prefix)+string(suffix) != expected {
+			t.Errorf("Unexpected NTLM hash for %q %s%s expected %s", password, prefix, suffix, expected)
+		}
+
+		prefix, suffix = ModeNTLM.hashBytes([]byte(password))
+
+		if string(prefix)+string(suffix) != expected {
+			t.Errorf("Unexpected NTLM hash of bytes for %q %s%s expected %s", password, prefix, suffix, expected)
+		}
+	}
+}
+
+func TestHashPasswordNTLMEncoding(t *testing.T) {
+	for _, password := range []string{"Pässwörd", "p😀ss", "invalid \xff\xfe utf-8", "\xed\xa0\x80"} {
+		encoded := utf16.Encode([]rune(password))
+
+		data := make([]byte, 0, 2*len(encoded))
+		for _, unit := range encoded {
+			data = append(data, byte(unit), byte(unit>>8))
+		}
+
+		sum := md4Sum(data)
+		expected := fmt.Sprintf("%X", sum[:])
+
+		prefix, suffix := ModeNTLM.hash(password)
+		if string(prefix)+string(suffix) != expected {
+			t.Errorf("Unexpected NTLM hash for %q %s%s expected %s", password, prefix, suffix, expected)
+		}
+
+		prefix, suffix = ModeNTLM.hashBytes([]byte(password))
+		if string(prefix)+string(suffix) != expected {
+			t.Errorf("Unexpected NTLM hash of bytes for %q %s%s expected %s", password, prefix, suffix, expected)
+		}
+	}
+}
+
+func testNTLMClient(url *string) *testHTTPClient {
+	return &testHTTPClient{
+		Fn: func(r *http.Request) (*http.Response, error) {
+			*url = r.URL.String()
+
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Status:     "200 OK",
+				Request:    r,
+				Body:       io.NopCloser(bytes.NewReader([]byte("0123456789ABCDEF0123456789A:1\r\n7EAEE8FB117AD06BDD830B7586C:5\r\n214943DAAD1D64C102FAEC29DE4AFE9DA3D:1\r\n"))),
+			}, nil
+		},
+	}
+}
+
+func TestCheckNTLM(t *testing.T) {
+	var url string
+
+	pwnedClient := PwnedClient{
+		Mode: ModeNTLM,
+		HTTP: testNTLMClient(&url),
+	}
+
+	count, err := pwnedClient.CheckCount(context.Background(), "password")
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	if count != 5 {
+		t.Errorf("Unexpected count %d", count)
+	}
+
+	if url != "https://api.pwnedpasswords.com/range/8846F?mode=ntlm" {
+		t.Errorf("Unexpected URL %q", url)
+	}
+}
+
+func TestCheckNTLMHash(t *testing.T) {
+	var url string
+
+	pwnedClient := PwnedClient{
+		HTTP: testNTLMClient(&url),
+	}
+
+	res, err := pwnedClient.CheckNTLMHash(context.Background(), "8846f7eaee8fb117ad06bdd830b7586c")
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	if !res {
+		t.Errorf("Expected result to be true, but was false")
+	}
+
+	if url != "https://api.pwnedpasswords.com/range/8846F?mode=ntlm" {
+		t.Errorf("Unexpected URL %q", url)
+	}
+
+	for _, hash := range []string{"8846F7EAEE8FB117AD06BDD830B7586", "8846F7EAEE8FB117AD06BDD830B7586G", "E38AD214943DAAD1D64C102FAEC29DE4AFE9DA3D"} {
+		_, err = pwnedClient.CheckNTLMHash(context.Background(), hash)
+
+		var eih *ErrorInvalidHash
+		if !errors.As(err, &eih) {
+			t.Errorf("Expected ErrorInvalidHash for %q, got %v", hash, err)
+		} else if eih.Length != 32 {
+			t.Errorf("Expected length 32 for %q, got %d", hash, eih.Length)
+		}
+	}
+
+	want := "hibp: Invalid password hash of length 31, must be 32 hex characters"
+	if _, err := pwnedClient.CheckNTLMHash(context.Background(), "8846F7EAEE8FB117AD06BDD830B7586"); err == nil || err.Error() != want {
+		t.Errorf("Expected error %q, got %v", want, err)
+	}
+}
+
+func TestMixedModesWithCache(t *testing.T) {
+	var urls []string
+
+	spans := 0
+
+	pwnedClient := PwnedClient{
+		Cache: NewLRUCache(10),
+		StartSpan: func(ctx context.Context, prefix string) (context.Context, func(SpanResult)) {
+			spans += 1
+
+			return ctx, func(SpanResult) {}
+		},
+		HTTP: &testHTTPClient{
+			Fn: func(r *http.Request) (*http.Response, error) {
+				urls = append(urls, r.URL.String())
+
+				body := "214943DAAD1D64C102FAEC29DE4AFE9DA3D:1\r\n"
+				if r.URL.Query().Get("mode") == "ntlm" {
+					body = "0123456789ABCDEF0123456789A:1\r\n"
+				}
+
+				return &http.Response{
+					StatusCode: http.StatusOK,
+					Status:     "200 OK",
+					Request:    r,
+					Body:       io.NopCloser(bytes.NewReader([]byte(body))),
+				}, nil
+			},
+		},
+	}
+
+	ctx := context.Background()
+
+	// the NTLM range of the same prefix as password1 is not recorded as
+	// its SHA-1 range
+	for i := 0; i < 2; i += 1 {
+		res, err := pwnedClient.CheckNTLMHash(ctx, "E38AD0123456789ABCDEF0123456789A")
+		if err != nil || !res {
+			t.Fatalf("Unexpected result %v %v", res, err)
+		}
+	}
+
+	res, err := pwnedClient.Check(ctx, "password1")
+	if err != nil || !res {
+		t.Fatalf("Unexpected result %v %v", res, err)
+	}
+
+	res, err = pwnedClient.Check(ctx, "password1")
+	if err != nil || !res {
+		t.Fatalf("Unexpected result %v %v", res, err)
+	}
+
+	expected := []string{
+		"https://api.pwnedpasswords.com/range/E38AD?mode=ntlm",
+		"https://api.pwnedpasswords.com/range/E38AD?mode=ntlm",
+		"https://api.pwnedpasswords.com/range/E38AD",
+	}
+
+	if fmt.Sprint(urls) != fmt.Sprint(expected) {
+		t.Errorf("Unexpected requests %q", urls)
+	}
+
+	if spans != 4 {
+		t.Errorf("Expected a span for each check, got %d", spans)
+	}
+}
+
+func TestCheckHashWithNTLMCache(t *testing.T) {
+	var url string
+
+	pwnedClient := PwnedClient{
+		Mode:  ModeNTLM,
+		Cache: NewLRUCache(10),
+		HTTP:  testNTLMClient(&url),
+	}
+
+	ctx := context.Background()
+
+	if err := pwnedClient.PrefetchPrefix(ctx, "E38AD"); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if url != "https://api.pwnedpasswords.com/range/E38AD?mode=ntlm" {
+		t.Errorf("Unexpected URL %q", url)
+	}
+
+	res, err := pwnedClient.CheckHash(ctx, "E38AD214943DAAD1D64C102FAEC29DE4AFE9DA3D")
+	if err != nil || !res {
+		t.Fatalf("Unexpected result %v %v", res, err)
+	}
+
+	if url != "https://api.pwnedpasswords.com/range/E38AD" {
+		t.Errorf("Expected the SHA-1 range to be fetched, got %q", url)
+	}
+}
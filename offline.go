@@ -0,0 +1,194 @@
+package hibp
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+)
+
+// OfflineSource serves range requests from a local copy of the Pwned
+// Passwords dataset in the official downloadable text format, so that no
+// network requests are made. Set it as PwnedClient.HTTP to switch a client
+// to the offline dataset, keeping the semantics of all checks.
+//
+// The file holds one "HASH:COUNT" line per hash, with the full uppercase hex
+// hash, sorted in ascending order of the hash as the official downloads are.
+// Ranges are found with a binary search over the file, so it is never read
+// in full. The hashes must be of the Mode of the client, such as the NTLM
+// download for ModeNTLM.
+type OfflineSource struct {
+	reader io.ReaderAt
+	size   int64
+	close  func() error
+}
+
+// NewOfflineSource creates an OfflineSource reading size bytes of the dataset
+// from reader.
+func NewOfflineSource(reader io.ReaderAt, size int64) *OfflineSource {
+	return &OfflineSource{
+		reader: reader,
+		size:   size,
+	}
+}
+
+// OpenOfflineSource opens the dataset file at path. Call Close to close the
+// file once the source is no longer used.
+func OpenOfflineSource(path string) (*OfflineSource, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	source := NewOfflineSource(file, info.Size())
+	source.close = file.Close
+
+	return source, nil
+}
+
+// Close closes the file opened by OpenOfflineSource. It does nothing for
+// sources created with NewOfflineSource.
+func (s *OfflineSource) Close() error {
+	if s.close == nil {
+		return nil
+	}
+
+	return s.close()
+}
+
+// Do serves a range request for the prefix in the last path segment of the
+// request URL with a response in the format of the Pwned Passwords API.
+func (s *OfflineSource) Do(req *http.Request) (*http.Response, error) {
+	if err := req.Context().Err(); err != nil {
+		return nil, err
+	}
+
+	prefix, err := normalizePrefix(path.Base(req.URL.Path))
+	if err != nil {
+		return &http.Response{
+			StatusCode: http.StatusBadRequest,
+			Status:     "400 Bad Request",
+			Request:    req,
+			Body:       http.NoBody,
+		}, nil
+	}
+
+	body, err := s.appendRange(nil, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	return &http.Response{
+		StatusCode:    http.StatusOK,
+		Status:        "200 OK",
+		Header:        http.Header{"Content-Type": []string{"text/plain"}},
+		Request:       req,
+		ContentLength: int64(len(body)),
+		Body:          io.NopCloser(bytes.NewReader(body)),
+	}, nil
+}
+
+// appendRange appends the "SUFFIX:COUNT" lines of all hashes with the prefix
+// to data.
+func (s *OfflineSource) appendRange(data []byte, prefix []byte) ([]byte, error) {
+	var searchErr error
+
+	// find the first line whose hash is not before the prefix
+	offset := sort.Search(int(s.size), func(offset int) bool {
+		start, err := s.lineStart(int64(offset))
+		if err != nil {
+			searchErr = err
+			return true
+		}
+
+		line, err := s.readLineAt(start)
+		if err != nil {
+			searchErr = err
+			return true
+		}
+
+		return line == nil || bytes.Compare(line[:min(len(line), len(prefix))], prefix) >= 0
+	})
+	if searchErr != nil {
+		return nil, searchErr
+	}
+
+	start, err := s.lineStart(int64(offset))
+	if err != nil {
+		return nil, err
+	}
+
+	scanner := bufio.NewScanner(io.NewSectionReader(s.reader, start, s.size-start))
+
+	for scanner.Scan() {
+		line := bytes.TrimRight(scanner.Bytes(), "\r")
+
+		if !bytes.HasPrefix(line, prefix) {
+			break
+		}
+
+		data = append(data, line[len(prefix):]...)
+		data = append(data, '\r', '\n')
+	}
+
+	return data, scanner.Err()
+}
+
+// lineStart returns the offset of the first line starting at or after offset.
+func (s *OfflineSource) lineStart(offset int64) (int64, error) {
+	if offset == 0 {
+		return 0, nil
+	}
+
+	chunk := make([]byte, 64)
+
+	// the line starts after the first line ending from the byte before
+	// offset on
+	for position := offset - 1; position < s.size; position += int64(len(chunk)) {
+		n, err := s.reader.ReadAt(chunk, position)
+
+		if index := bytes.IndexByte(chunk[:n], '\n'); index >= 0 {
+			return position + int64(index) + 1, nil
+		}
+
+		if err != nil && !errors.Is(err, io.EOF) {
+			return 0, err
+		}
+	}
+
+	return s.size, nil
+}
+
+// readLineAt returns the line starting at offset without its line ending, or
+// nil at the end of the file.
+func (s *OfflineSource) readLineAt(offset int64) ([]byte, error) {
+	if offset >= s.size {
+		return nil, nil
+	}
+
+	// lines are at most a hash, a count and a line ending
+	line := make([]byte, min(128, s.size-offset))
+
+	n, err := s.reader.ReadAt(line, offset)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	line = line[:n]
+
+	if end := bytes.IndexAny(line, "\r\n"); end >= 0 {
+		line = line[:end]
+	}
+
+	return line, nil
+}
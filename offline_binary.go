@@ -0,0 +1,109 @@
+package hibp
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/binary"
+	"fmt"
+	"sort"
+)
+
+// binaryRecordSize is the size of a single record in the binary offline
+// format: the raw SHA-1 digest followed by the occurrence count.
+const binaryRecordSize = sha1.Size + 4
+
+// BinaryOfflineChecker checks passwords against a local copy of the Pwned
+// Passwords dataset stored in a compact binary format. The file is
+// memory-mapped and searched with a binary search, so no network requests are
+// made.
+//
+// The format is specific to this package: the file is a sequence of
+// fixed-width 24 byte records, each holding the raw 20 byte SHA-1 digest
+// followed by the occurrence count as a big-endian uint32, with records sorted
+// in ascending order of the digest. Files produced by other tools, such as the
+// PwnedPasswordsDownloader, are not guaranteed to use this layout and must be
+// converted first.
+type BinaryOfflineChecker struct {
+	data  []byte
+	close func() error
+}
+
+// NewBinaryOfflineChecker memory-maps the binary file at path. Call Close to
+// release the mapping once the checker is no longer used.
+func NewBinaryOfflineChecker(path string) (*BinaryOfflineChecker, error) {
+	data, closeFn, err := mapFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data)%binaryRecordSize != 0 {
+		closeFn()
+
+		return nil, fmt.Errorf("hibp: Binary offline file %q has size %d which is not a multiple of the record size %d", path, len(data), binaryRecordSize)
+	}
+
+	return &BinaryOfflineChecker{
+		data:  data,
+		close: closeFn,
+	}, nil
+}
+
+// Check reports whether the password is found in the dataset. The context is
+// accepted for parity with PwnedClient.Check, the lookup itself never blocks.
+func (c *BinaryOfflineChecker) Check(ctx context.Context, password string) (bool, error) {
+	count, err := c.CheckCount(ctx, password)
+
+	return count > 0, err
+}
+
+// CheckCount returns the number of times the password appears in the
+// dataset, or 0 if it does not.
+func (c *BinaryOfflineChecker) CheckCount(ctx context.Context, password string) (int, error) {
+	if ctx != nil {
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+	}
+
+	sum := sha1.Sum([]byte(password))
+
+	return int(c.lookup(sum[:])), nil
+}
+
+// lookup searches the records for the digest and returns its count.
+func (c *BinaryOfflineChecker) lookup(digest []byte) uint32 {
+	records := len(c.data) / binaryRecordSize
+
+	index := sort.Search(records, func(i int) bool {
+		return bytes.Compare(c.record(i)[:sha1.Size], digest) >= 0
+	})
+
+	if index < records {
+		record := c.record(index)
+
+		if bytes.Equal(record[:sha1.Size], digest) {
+			return binary.BigEndian.Uint32(record[sha1.Size:])
+		}
+	}
+
+	return 0
+}
+
+func (c *BinaryOfflineChecker) record(i int) []byte {
+	return c.data[i*binaryRecordSize : (i+1)*binaryRecordSize]
+}
+
+// Close releases the memory mapping. The checker must not be used after.
+func (c *BinaryOfflineChecker) Close() error {
+	if c.close == nil {
+		return nil
+	}
+
+	closeFn := c.close
+
+	c.close = nil
+	c.data = nil
+
+	return closeFn()
+}
@@ -0,0 +1,183 @@
+package hibp
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func writeBinaryOfflineFile(t *testing.T, counts map[string]uint32) string {
+	digests := make([][]byte, 0, len(counts))
+	for password := range counts {
+		sum := sha1.Sum([]byte(password))
+		digests = append(digests, sum[:])
+	}
+
+	sort.Slice(digests, func(i, j int) bool {
+		return bytes.Compare(digests[i], digests[j]) < 0
+	})
+
+	byDigest := make(map[string]uint32, len(counts))
+	for password, count := range counts {
+		sum := sha1.Sum([]byte(password))
+		byDigest[string(sum[:])] = count
+	}
+
+	data := make([]byte, 0, len(digests)*binaryRecordSize)
+	for _, digest := range digests {
+		data = append(data, digest...)
+		data = binary.BigEndian.AppendUint32(data, byDigest[string(digest)])
+	}
+
+	path := filepath.Join(t.TempDir(), "pwned.bin")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("Unable to write file %v", err)
+	}
+
+	return path
+}
+
+func TestBinaryOfflineChecker(t *testing.T) {
+	counts := map[string]uint32{
+		"password1": 2418984,
+		"123456":    37359195,
+		"qwerty":    10,
+		"letmein":   1,
+	}
+
+	checker, err := NewBinaryOfflineChecker(writeBinaryOfflineFile(t, counts))
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	defer checker.Close()
+
+	for password, expected := range counts {
+		count, err := checker.CheckCount(context.Background(), password)
+		if err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+
+		if count != int(expected) {
+			t.Errorf("Expected count %d for %q, got %d", expected, password, count)
+		}
+
+		pwned, err := checker.Check(context.Background(), password)
+		if err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+
+		if !pwned {
+			t.Errorf("Expected %q to be pwned", password)
+		}
+	}
+
+	pwned, err := checker.Check(context.Background(), "not in the file")
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	if pwned {
+		t.Errorf("Found password that is not in the file")
+	}
+
+	if err := checker.Close(); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	if err := checker.Close(); err != nil {
+		t.Errorf("Unexpected error on second Close %v", err)
+	}
+}
+
+func TestBinaryOfflineCheckerLayout(t *testing.T) {
+	// Two hand-written records pinning the documented layout: the raw SHA-1
+	// digests of "password" and "123456" in ascending order, each followed by
+	// a big-endian uint32 count.
+	data, err := hex.DecodeString("" +
+		"5baa61e4c9b93f3f0682250b6cf8331b7ee68fd8" + "00010203" +
+		"7c4a8d09ca3762af61e59520943dc26494f8941b" + "0000002a")
+	if err != nil {
+		t.Fatalf("Unable to decode fixture %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "pwned.bin")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("Unable to write file %v", err)
+	}
+
+	checker, err := NewBinaryOfflineChecker(path)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	defer checker.Close()
+
+	for password, expected := range map[string]int{"password": 0x00010203, "123456": 42, "letmein": 0} {
+		count, err := checker.CheckCount(context.Background(), password)
+		if err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+
+		if count != expected {
+			t.Errorf("Expected count %d for %q, got %d", expected, password, count)
+		}
+	}
+}
+
+func TestBinaryOfflineCheckerEmptyFile(t *testing.T) {
+	checker, err := NewBinaryOfflineChecker(writeBinaryOfflineFile(t, nil))
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	defer checker.Close()
+
+	pwned, err := checker.Check(context.Background(), "password1")
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	if pwned {
+		t.Errorf("Found password in an empty file")
+	}
+}
+
+func TestBinaryOfflineCheckerInvalidSize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pwned.bin")
+	if err := os.WriteFile(path, make([]byte, binaryRecordSize+1), 0o600); err != nil {
+		t.Fatalf("Unable to write file %v", err)
+	}
+
+	_, err := NewBinaryOfflineChecker(path)
+	if err == nil {
+		t.Errorf("Expected error for file with invalid size")
+	}
+
+	_, err = NewBinaryOfflineChecker(filepath.Join(t.TempDir(), "missing.bin"))
+	if err == nil {
+		t.Errorf("Expected error for missing file")
+	}
+}
+
+func TestBinaryOfflineCheckerCanceledContext(t *testing.T) {
+	checker, err := NewBinaryOfflineChecker(writeBinaryOfflineFile(t, map[string]uint32{"password1": 1}))
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	defer checker.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := checker.Check(ctx, "password1"); err != context.Canceled {
+		t.Errorf("Unexpected error %v", err)
+	}
+}
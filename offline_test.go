@@ -0,0 +1,97 @@
+package hibp
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func testOfflineDataset() string {
+	hashes := []string{
+		// password1
+		"E38AD214943DAAD1D64C102FAEC29DE4AFE9DA3D:7",
+		// password2
+		"2AA60A8FF7FCD473D321E0146AFD9E26DF395147:3",
+		fmt.Sprintf("E38AD%035d:1", 0),
+		fmt.Sprintf("E38AE%035d:2", 0),
+		fmt.Sprintf("E38AC%035d:2", 0),
+		fmt.Sprintf("FFFFF%035d:9", 0),
+	}
+
+	for i := 0; i < 200; i += 1 {
+		hashes = append(hashes, fmt.Sprintf("%05X%035X:%d", i*0x1000, i, i+1))
+	}
+
+	sort.Strings(hashes)
+
+	return strings.Join(hashes, "\r\n") + "\r\n"
+}
+
+func TestOfflineSource(t *testing.T) {
+	dataset := testOfflineDataset()
+
+	source := NewOfflineSource(strings.NewReader(dataset), int64(len(dataset)))
+
+	pwnedClient := PwnedClient{
+		HTTP: source,
+	}
+
+	examples := []struct {
+		password string
+		count    int
+	}{
+		{"password1", 7},
+		{"password2", 3},
+		{"password3", 0},
+	}
+
+	for _, example := range examples {
+		count, err := pwnedClient.CheckCount(context.Background(), example.password)
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+
+		if count != example.count {
+			t.Errorf("Unexpected count %d for %q, expected %d", count, example.password, example.count)
+		}
+	}
+
+	for _, prefix := range []string{"00000", "C7000", "FFFFF", "E38AD"} {
+		counts, err := pwnedClient.Range(context.Background(), prefix)
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+
+		expected := strings.Count(dataset, "\n"+prefix) + strings.Count(dataset[:5], prefix)
+		if len(counts) != expected {
+			t.Errorf("Unexpected range for %q %v, expected %d entries", prefix, counts, expected)
+		}
+	}
+}
+
+func TestOpenOfflineSource(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pwned-passwords-sha1-ordered-by-hash.txt")
+
+	if err := os.WriteFile(path, []byte(testOfflineDataset()), 0o600); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	source, err := OpenOfflineSource(path)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer source.Close()
+
+	pwnedClient := PwnedClient{
+		HTTP: source,
+	}
+
+	res, err := pwnedClient.Check(context.Background(), "password1")
+	if err != nil || !res {
+		t.Errorf("Unexpected result %v %v", res, err)
+	}
+}
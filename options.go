@@ -0,0 +1,84 @@
+package hibp
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Option configures a PwnedClient created with NewPwnedClient.
+type Option func(*PwnedClient)
+
+// WithUserAgent sets PwnedClient.UserAgent.
+func WithUserAgent(userAgent string) Option {
+	return func(c *PwnedClient) {
+		c.UserAgent = userAgent
+	}
+}
+
+// WithCache sets PwnedClient.Cache.
+func WithCache(cache PwnedCache) Option {
+	return func(c *PwnedClient) {
+		c.Cache = cache
+	}
+}
+
+// WithHTTPClient sets PwnedClient.HTTP.
+func WithHTTPClient(client interface {
+	Do(*http.Request) (*http.Response, error)
+}) Option {
+	return func(c *PwnedClient) {
+		c.HTTP = client
+	}
+}
+
+// WithTimeout sets PwnedClient.Timeout.
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *PwnedClient) {
+		c.Timeout = timeout
+	}
+}
+
+// WithMode sets PwnedClient.Mode.
+func WithMode(mode Mode) Option {
+	return func(c *PwnedClient) {
+		c.Mode = mode
+	}
+}
+
+// WithBaseURL sets PwnedClient.BaseURL.
+func WithBaseURL(baseURL string) Option {
+	return func(c *PwnedClient) {
+		c.BaseURL = baseURL
+	}
+}
+
+// NewPwnedClient creates a PwnedClient configured with the options, applied in
+// order so later options override earlier ones. Unset options keep the
+// defaults of the zero PwnedClient. An error is returned if the resulting
+// configuration is invalid.
+func NewPwnedClient(opts ...Option) (*PwnedClient, error) {
+	c := &PwnedClient{}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	if c.Timeout < 0 {
+		return nil, fmt.Errorf("hibp: Timeout %v must not be negative", c.Timeout)
+	}
+
+	if c.Mode != ModeSHA1 && c.Mode != ModeNTLM {
+		return nil, fmt.Errorf("hibp: Unknown mode %d", c.Mode)
+	}
+
+	if c.BaseURL != "" {
+		baseURL, err := url.Parse(c.BaseURL)
+		if err != nil || (baseURL.Scheme != "http" && baseURL.Scheme != "https") || baseURL.Host == "" {
+			return nil, fmt.Errorf("hibp: BaseURL %q must be an absolute HTTP or HTTPS URL", c.BaseURL)
+		}
+	}
+
+	return c, nil
+}
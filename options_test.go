@@ -0,0 +1,77 @@
+package hibp
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestNewPwnedClient(t *testing.T) {
+	pwnedClient, err := NewPwnedClient()
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if pwnedClient.Mode != ModeSHA1 || pwnedClient.UserAgent != "" || pwnedClient.Cache != nil || pwnedClient.HTTP != nil || pwnedClient.Timeout != 0 || pwnedClient.BaseURL != "" {
+		t.Errorf("Unexpected defaults %+v", pwnedClient)
+	}
+
+	var url, userAgent string
+
+	cache := NewLRUCache(10)
+
+	pwnedClient, err = NewPwnedClient(
+		WithUserAgent("first"),
+		WithCache(cache),
+		WithTimeout(time.Second),
+		WithMode(ModeNTLM),
+		WithBaseURL("https://mirror.example.com/range"),
+		WithHTTPClient(&testHTTPClient{
+			Fn: func(r *http.Request) (*http.Response, error) {
+				url = r.URL.String()
+				userAgent = r.UserAgent()
+
+				return nil, context.Canceled
+			},
+		}),
+		WithUserAgent("second"),
+	)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if pwnedClient.Cache != cache || pwnedClient.Timeout != time.Second {
+		t.Errorf("Unexpected configuration %+v", pwnedClient)
+	}
+
+	_, err = pwnedClient.Check(context.Background(), "Password")
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	if url != "https://mirror.example.com/range/A4F49?mode=ntlm" {
+		t.Errorf("Unexpected URL %q", url)
+	}
+
+	if userAgent != "second" {
+		t.Errorf("Expected later options to override earlier ones, got User-Agent %q", userAgent)
+	}
+}
+
+func TestNewPwnedClientInvalid(t *testing.T) {
+	examples := [][]Option{
+		{WithTimeout(-time.Second)},
+		{WithMode(Mode(42))},
+		{WithBaseURL("mirror.example.com/range")},
+		{WithBaseURL("ftp://mirror.example.com/range")},
+	}
+
+	for i, opts := range examples {
+		pwnedClient, err := NewPwnedClient(opts...)
+		if err == nil || pwnedClient != nil {
+			t.Errorf("Example %d: expected an error", i)
+		}
+	}
+}
@@ -2,16 +2,74 @@ package hibp
 
 import (
 	"bytes"
+	"compress/gzip"
+	"io"
 	"sync"
+	"sync/atomic"
 )
 
+// DefaultPoolBufferCapacity and DefaultPoolSuffixesCapacity are the initial
+// capacities of pooled objects unless changed with SetPoolCapacities.
+const (
+	DefaultPoolBufferCapacity   = 4 * 1024
+	DefaultPoolSuffixesCapacity = 1024
+)
+
+// poolGrowthLimit is how many times their configured capacity pooled objects
+// may grow to before they are discarded instead of returned to their pool.
+const poolGrowthLimit = 4
+
+// maxPooledBufferBytes and maxPooledSuffixes are the largest capacities of
+// objects returned to the pools, regardless of the configured capacities, so
+// that the memory held by the pools stays bounded.
+const (
+	maxPooledBufferBytes = 256 * 1024
+	maxPooledSuffixes    = 8 * 1024
+)
+
+// poolBufferCapacity and poolSuffixesCapacity hold the capacities configured
+// with SetPoolCapacities.
+var (
+	poolBufferCapacity   atomic.Int64
+	poolSuffixesCapacity atomic.Int64
+)
+
+func init() {
+	SetPoolCapacities(DefaultPoolBufferCapacity, DefaultPoolSuffixesCapacity)
+}
+
+// SetPoolCapacities sets the initial capacities of the pooled buffers that
+// responses are read into, in bytes, and of the pooled slices holding their
+// suffixes, such as to right-size them for responses with padding or in NTLM
+// mode. Non-positive values restore the defaults, and capacities are limited
+// to 256KB and 8192 suffixes. Pooled objects that grew to more than 4 times
+// the configured capacity (or beyond these limits) while handling an unusually
+// large response are discarded instead of returned to their pool. It is safe
+// to call concurrently with checks, and affects objects allocated afterwards.
+func SetPoolCapacities(bufferBytes, suffixes int) {
+	if bufferBytes <= 0 {
+		bufferBytes = DefaultPoolBufferCapacity
+	}
+
+	if suffixes <= 0 {
+		suffixes = DefaultPoolSuffixesCapacity
+	}
+
+	bufferBytes = min(bufferBytes, maxPooledBufferBytes)
+	suffixes = min(suffixes, maxPooledSuffixes)
+
+	poolBufferCapacity.Store(int64(bufferBytes))
+	poolSuffixesCapacity.Store(int64(suffixes))
+}
+
 // bufferPool holds a pool of *bytes.Buffer used to read only valid responses
-// from the HaveIBeenPwned.org API. Invalid responses (like a 503 error) do not
-// use a buffer from here.
+// from the HaveIBeenPwned.org API into while parsing them line by line.
+// Invalid responses (like a 503 error) do not use a buffer from here.
 var bufferPool = &sync.Pool{
 	New: func() any {
-		// usual responses from HIBP are around 42kb
-		return bytes.NewBuffer(make([]byte, 0, 42*1024))
+		// responses are parsed line by line, so the buffer only needs
+		// to hold a chunk of a response
+		return bytes.NewBuffer(make([]byte, 0, poolBufferCapacity.Load()))
 	},
 }
 
@@ -20,7 +78,78 @@ var bufferPool = &sync.Pool{
 var suffixesPool = &sync.Pool{
 	New: func() any {
 		// usually there are around 1000 suffixes per response
-		buf := make([][]byte, 0, 1024)
+		buf := make([][]byte, 0, poolSuffixesCapacity.Load())
 		return &buf
 	},
 }
+
+// gzipReaderPool holds a pool of *gzip.Reader used to decompress gzip encoded
+// responses from the Pwned Passwords API.
+var gzipReaderPool = &sync.Pool{}
+
+// acquireGzipReader returns a gzip.Reader from the pool reading from r.
+// Release it with releaseGzipReader.
+func acquireGzipReader(r io.Reader) (*gzip.Reader, error) {
+	if reader, ok := gzipReaderPool.Get().(*gzip.Reader); ok {
+		if err := reader.Reset(r); err != nil {
+			return nil, err
+		}
+
+		return reader, nil
+	}
+
+	return gzip.NewReader(r)
+}
+
+// releaseGzipReader returns a reader acquired with acquireGzipReader to the
+// pool. It must not be used after.
+func releaseGzipReader(reader *gzip.Reader) {
+	gzipReaderPool.Put(reader)
+}
+
+// poolable reports whether an object with the capacity may be returned to its
+// pool, given the configured capacity and the absolute limit.
+func poolable(capacity int, configured int64, limit int64) bool {
+	return int64(capacity) <= min(poolGrowthLimit*configured, limit)
+}
+
+// acquireResultBuffer returns an empty pwnedResultBuffer backed by a buffer
+// and suffixes slice from the pools. Release it with releaseResultBuffer.
+func acquireResultBuffer() *pwnedResultBuffer {
+	buffer := bufferPool.Get().(*bytes.Buffer)
+	buffer.Reset()
+
+	suffixes := suffixesPool.Get().(*[][]byte)
+
+	return &pwnedResultBuffer{
+		Buffer: buffer,
+
+		// the pooled slice may still have the length from its
+		// previous use, which would leak stale suffixes
+		Suffixes:       (*suffixes)[:0],
+		pooledSuffixes: suffixes,
+	}
+}
+
+// releaseResultBuffer returns the buffer and suffixes slice of a buffer
+// acquired with acquireResultBuffer to the pools. It must not be used after.
+func releaseResultBuffer(buf *pwnedResultBuffer) {
+	// objects that grew far beyond the configured capacity would keep
+	// that memory alive in the pool, so leave them to the GC
+	if poolable(buf.Buffer.Cap(), poolBufferCapacity.Load(), maxPooledBufferBytes) {
+		bufferPool.Put(buf.Buffer)
+	}
+
+	if poolable(cap(buf.Suffixes), poolSuffixesCapacity.Load(), maxPooledSuffixes) {
+		// drop references to the suffixes so they can be collected,
+		// and keep the slice's (possibly grown) capacity for the next
+		// use
+		clear(buf.Suffixes)
+		*buf.pooledSuffixes = buf.Suffixes[:0]
+		suffixesPool.Put(buf.pooledSuffixes)
+	}
+
+	buf.Buffer = nil
+	buf.Suffixes = nil
+	buf.pooledSuffixes = nil
+}
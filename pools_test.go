@@ -0,0 +1,147 @@
+package hibp
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestResultBufferPoolReuse(t *testing.T) {
+	for i := 0; i < 10; i += 1 {
+		buf := acquireResultBuffer()
+
+		if len(buf.Suffixes) != 0 {
+			t.Fatalf("Pooled suffixes contain stale data %q", buf.Suffixes)
+		}
+
+		if buf.Buffer.Len() != 0 {
+			t.Fatalf("Pooled buffer contains stale data %q", buf.Buffer.Bytes())
+		}
+
+		if err := buf.ParseFrom(bytes.NewReader([]byte("0123456789ABCDEF0123456789ABCDEF012:1\n"))); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+
+		buf.Buffer.WriteString("leftover")
+
+		if len(buf.Suffixes) != 1 {
+			t.Fatalf("Unexpected suffixes %q", buf.Suffixes)
+		}
+
+		releaseResultBuffer(buf)
+	}
+
+	// simulate a pool entry that was put back without being truncated
+	stale := [][]byte{[]byte("0123456789ABCDEF0123456789ABCDEF012")}
+	suffixesPool.Put(&stale)
+
+	buf := acquireResultBuffer()
+	defer releaseResultBuffer(buf)
+
+	if len(buf.Suffixes) != 0 {
+		t.Errorf("Pooled suffixes contain stale data %q", buf.Suffixes)
+	}
+
+	if buf.Lookup([]byte("0123456789ABCDEF0123456789ABCDEF012")) {
+		t.Errorf("Found stale suffix from a previous use")
+	}
+}
+
+func TestReleaseResultBufferDiscardsOversized(t *testing.T) {
+	defer SetPoolCapacities(0, 0)
+
+	SetPoolCapacities(128, 16)
+
+	if capacity := bufferPool.New().(*bytes.Buffer).Cap(); capacity != 128 {
+		t.Errorf("Unexpected buffer capacity %d", capacity)
+	}
+
+	if capacity := cap(*suffixesPool.New().(*[][]byte)); capacity != 16 {
+		t.Errorf("Unexpected suffixes capacity %d", capacity)
+	}
+
+	buf := acquireResultBuffer()
+
+	buf.Buffer.Grow(poolGrowthLimit*128 + 1)
+
+	for i := 0; i < poolGrowthLimit*16+1; i += 1 {
+		buf.Suffixes = append(buf.Suffixes, nil)
+	}
+
+	buffer := buf.Buffer
+	suffixes := buf.pooledSuffixes
+
+	releaseResultBuffer(buf)
+
+	// the pools may drop entries at any time, but never return the
+	// discarded objects
+	for i := 0; i < 10; i += 1 {
+		buf := acquireResultBuffer()
+
+		if buf.Buffer == buffer || buf.pooledSuffixes == suffixes {
+			t.Fatalf("Oversized objects were returned to the pools")
+		}
+
+		defer releaseResultBuffer(buf)
+	}
+}
+
+func BenchmarkResultBufferPool(b *testing.B) {
+	defer SetPoolCapacities(0, 0)
+
+	suffix := []byte("0123456789ABCDEF0123456789ABCDEF012")
+
+	// a heavily padded response with far more suffixes than usual
+	const suffixes = 8 * DefaultPoolSuffixesCapacity
+
+	for _, example := range []struct {
+		name     string
+		capacity int
+	}{
+		{"default", 0},
+		{"right-sized", suffixes},
+	} {
+		b.Run(example.name, func(b *testing.B) {
+			SetPoolCapacities(0, example.capacity)
+
+			b.ReportAllocs()
+
+			for i := 0; i < b.N; i += 1 {
+				buf := acquireResultBuffer()
+
+				for j := 0; j < suffixes; j += 1 {
+					buf.Suffixes = append(buf.Suffixes, suffix)
+				}
+
+				releaseResultBuffer(buf)
+			}
+		})
+	}
+}
+
+func TestPoolable(t *testing.T) {
+	examples := []struct {
+		Capacity   int
+		Configured int64
+		Poolable   bool
+	}{
+		{4 * 1024, 4 * 1024, true},
+		{16 * 1024, 4 * 1024, true},
+		{16*1024 + 1, 4 * 1024, false},
+		{maxPooledBufferBytes, maxPooledBufferBytes, true},
+		{maxPooledBufferBytes + 1, 128 * 1024, false},
+	}
+
+	for _, example := range examples {
+		if poolable(example.Capacity, example.Configured, maxPooledBufferBytes) != example.Poolable {
+			t.Errorf("Unexpected result for capacity %d configured %d", example.Capacity, example.Configured)
+		}
+	}
+
+	defer SetPoolCapacities(0, 0)
+
+	SetPoolCapacities(1<<30, 1<<30)
+
+	if poolBufferCapacity.Load() != maxPooledBufferBytes || poolSuffixesCapacity.Load() != maxPooledSuffixes {
+		t.Errorf("Expected capacities to be limited, got %d %d", poolBufferCapacity.Load(), poolSuffixesCapacity.Load())
+	}
+}
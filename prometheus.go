@@ -0,0 +1,238 @@
+package hibp
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultPrometheusBuckets are the upper bounds, in seconds, of the request
+// duration histogram of PrometheusCollector when its Buckets are not set.
+var DefaultPrometheusBuckets = []float64{0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// PrometheusCollector collects metrics of PwnedClients through their hooks
+// and serves them in the Prometheus text exposition format, so they can be
+// scraped without depending on a Prometheus client library. Mount it as an
+// http.Handler, such as on /metrics. Zero value is ready to use.
+type PrometheusCollector struct {
+	// Namespace prefixes the metric names, "hibp" if empty.
+	Namespace string
+
+	// Buckets are the upper bounds, in seconds, of the request duration
+	// histogram, DefaultPrometheusBuckets if nil. Set it before the
+	// collector is used.
+	Buckets []float64
+
+	lock sync.Mutex
+
+	clients []*PwnedClient
+
+	cacheHits   uint64
+	cacheMisses uint64
+	coalesced   uint64
+
+	// requests counts requests by status code, 0 for requests that
+	// failed without a response.
+	requests map[int]uint64
+
+	bucketCounts  []uint64
+	durationSum   float64
+	durationCount uint64
+}
+
+// Instrument wires the collector to the hooks of the client, calling any hooks
+// already set after recording the metrics. Call it before the client is used.
+func (p *PrometheusCollector) Instrument(c *PwnedClient) {
+	p.lock.Lock()
+	p.clients = append(p.clients, c)
+	p.lock.Unlock()
+
+	onRequest := c.OnRequest
+	c.OnRequest = func(prefix string, dur time.Duration, status int, err error) {
+		p.observeRequest(dur, status)
+
+		if onRequest != nil {
+			onRequest(prefix, dur, status, err)
+		}
+	}
+
+	onCacheHit := c.OnCacheHit
+	c.OnCacheHit = func(prefix string) {
+		p.add(&p.cacheHits)
+
+		if onCacheHit != nil {
+			onCacheHit(prefix)
+		}
+	}
+
+	onCacheMiss := c.OnCacheMiss
+	c.OnCacheMiss = func(prefix string) {
+		p.add(&p.cacheMisses)
+
+		if onCacheMiss != nil {
+			onCacheMiss(prefix)
+		}
+	}
+
+	onCoalesced := c.OnCoalesced
+	c.OnCoalesced = func(prefix string) {
+		p.add(&p.coalesced)
+
+		if onCoalesced != nil {
+			onCoalesced(prefix)
+		}
+	}
+}
+
+// add increments the counter under the lock.
+func (p *PrometheusCollector) add(counter *uint64) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	*counter += 1
+}
+
+// buckets returns the effective Buckets.
+func (p *PrometheusCollector) buckets() []float64 {
+	if p.Buckets == nil {
+		return DefaultPrometheusBuckets
+	}
+
+	return p.Buckets
+}
+
+// observeRequest records a request that took dur and returned the status.
+func (p *PrometheusCollector) observeRequest(dur time.Duration, status int) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.requests == nil {
+		p.requests = make(map[int]uint64)
+	}
+
+	p.requests[status] += 1
+
+	buckets := p.buckets()
+
+	if p.bucketCounts == nil {
+		p.bucketCounts = make([]uint64, len(buckets))
+	}
+
+	seconds := dur.Seconds()
+
+	for i, bound := range buckets {
+		if seconds <= bound {
+			p.bucketCounts[i] += 1
+		}
+	}
+
+	p.durationSum += seconds
+	p.durationCount += 1
+}
+
+// ServeHTTP writes the metrics in the Prometheus text exposition format.
+func (p *PrometheusCollector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+	p.WriteTo(w)
+}
+
+// WriteTo writes the metrics in the Prometheus text exposition format to w.
+func (p *PrometheusCollector) WriteTo(w io.Writer) (int64, error) {
+	namespace := p.Namespace
+	if namespace == "" {
+		namespace = "hibp"
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	var checks, failed int64
+
+	for _, c := range p.clients {
+		stats := c.Stats()
+
+		checks += stats.Checks
+		failed += stats.Errors
+	}
+
+	counted := &countingWriter{
+		w: w,
+	}
+
+	b := bufio.NewWriter(counted)
+
+	metric := func(name, kind, help string) {
+		fmt.Fprintf(b, "# HELP %s_%s %s\n# TYPE %s_%s %s\n", namespace, name, help, namespace, name, kind)
+	}
+
+	metric("checks_total", "counter", "Number of passwords and hashes checked.")
+	fmt.Fprintf(b, "%s_checks_total %d\n", namespace, checks)
+
+	metric("check_errors_total", "counter", "Number of checks that returned an error.")
+	fmt.Fprintf(b, "%s_check_errors_total %d\n", namespace, failed)
+
+	metric("cache_hits_total", "counter", "Number of checks answered by the cache.")
+	fmt.Fprintf(b, "%s_cache_hits_total %d\n", namespace, p.cacheHits)
+
+	metric("cache_misses_total", "counter", "Number of checks the cache could not answer.")
+	fmt.Fprintf(b, "%s_cache_misses_total %d\n", namespace, p.cacheMisses)
+
+	metric("coalesced_total", "counter", "Number of checks that joined an in-flight request.")
+	fmt.Fprintf(b, "%s_coalesced_total %d\n", namespace, p.coalesced)
+
+	metric("requests_total", "counter", "Number of requests to the Pwned Passwords API by status code.")
+
+	statuses := make([]int, 0, len(p.requests))
+	for status := range p.requests {
+		statuses = append(statuses, status)
+	}
+
+	sort.Ints(statuses)
+
+	for _, status := range statuses {
+		label := strconv.Itoa(status)
+		if status == 0 {
+			label = "error"
+		}
+
+		fmt.Fprintf(b, "%s_requests_total{status=%q} %d\n", namespace, label, p.requests[status])
+	}
+
+	metric("request_duration_seconds", "histogram", "Duration of requests to the Pwned Passwords API.")
+
+	for i, bound := range p.buckets() {
+		count := uint64(0)
+		if p.bucketCounts != nil {
+			count = p.bucketCounts[i]
+		}
+
+		fmt.Fprintf(b, "%s_request_duration_seconds_bucket{le=%q} %d\n", namespace, strconv.FormatFloat(bound, 'g', -1, 64), count)
+	}
+
+	fmt.Fprintf(b, "%s_request_duration_seconds_bucket{le=\"+Inf\"} %d\n", namespace, p.durationCount)
+	fmt.Fprintf(b, "%s_request_duration_seconds_sum %s\n", namespace, strconv.FormatFloat(p.durationSum, 'g', -1, 64))
+	fmt.Fprintf(b, "%s_request_duration_seconds_count %d\n", namespace, p.durationCount)
+
+	err := b.Flush()
+
+	return counted.n, err
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+
+	return n, err
+}
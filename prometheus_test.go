@@ -0,0 +1,66 @@
+package hibp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPrometheusCollector(t *testing.T) {
+	calls := 0
+	requests := 0
+
+	pwnedClient := &PwnedClient{
+		Cache: NewLRUCache(10),
+		HTTP:  testStatusSequenceClient(&calls, []int{http.StatusOK, http.StatusServiceUnavailable}, nil),
+		OnRequest: func(prefix string, dur time.Duration, status int, err error) {
+			requests += 1
+		},
+	}
+
+	collector := &PrometheusCollector{
+		Buckets: []float64{0.5, 100},
+	}
+
+	collector.Instrument(pwnedClient)
+
+	for _, password := range []string{"password1", "password1", "password2"} {
+		pwnedClient.Check(context.Background(), password)
+	}
+
+	if requests != 2 {
+		t.Errorf("Expected existing hooks to be called, got %d requests", requests)
+	}
+
+	recorder := httptest.NewRecorder()
+	collector.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if contentType := recorder.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "text/plain; version=0.0.4") {
+		t.Errorf("Unexpected Content-Type %q", contentType)
+	}
+
+	body := recorder.Body.String()
+
+	for _, line := range []string{
+		"# TYPE hibp_checks_total counter",
+		"hibp_checks_total 3",
+		"hibp_check_errors_total 1",
+		"hibp_cache_hits_total 1",
+		"hibp_cache_misses_total 2",
+		"hibp_coalesced_total 0",
+		`hibp_requests_total{status="200"} 1`,
+		`hibp_requests_total{status="503"} 1`,
+		"# TYPE hibp_request_duration_seconds histogram",
+		`hibp_request_duration_seconds_bucket{le="0.5"} 2`,
+		`hibp_request_duration_seconds_bucket{le="100"} 2`,
+		`hibp_request_duration_seconds_bucket{le="+Inf"} 2`,
+		"hibp_request_duration_seconds_count 2",
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("Missing %q in:\n%s", line, body)
+		}
+	}
+}
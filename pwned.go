@@ -1,28 +1,92 @@
 package hibp
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"crypto/sha1"
-	"encoding/hex"
+	"crypto/x509"
+	"io"
+	"math"
+	"mime"
 	"net/http"
+	"net/url"
+	"path"
 	"regexp"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 )
 
-// PwnedPasswordsURL returns the URL for the prefix.
+// prefixLength is the number of hex characters of the hash sent to the Pwned
+// Passwords API.
+const prefixLength = 5
+
+// normalizePrefix uppercases the prefix and validates that it consists of
+// exactly 5 hex characters.
+func normalizePrefix(prefix string) ([]byte, error) {
+	if len(prefix) != prefixLength {
+		return nil, &ErrorInvalidPrefix{
+			Prefix: prefix,
+		}
+	}
+
+	normalized := []byte(strings.ToUpper(prefix))
+
+	for _, ch := range normalized {
+		if (ch < '0' || ch > '9') && (ch < 'A' || ch > 'F') {
+			return nil, &ErrorInvalidPrefix{
+				Prefix: prefix,
+			}
+		}
+	}
+
+	return normalized, nil
+}
+
+// DefaultBaseURL is the base URL of the range endpoint of the public Pwned
+// Passwords API, used when PwnedClient.BaseURL is not set.
+const DefaultBaseURL = "https://api.pwnedpasswords.com/range/"
+
+// PwnedPasswordsURL returns the URL for the prefix, which is uppercased but
+// not otherwise validated. Use RangeURL to reject invalid prefixes.
 func PwnedPasswordsURL(prefix string) string {
-	return "https://api.pwnedpasswords.com/range/" + prefix
+	return DefaultBaseURL + strings.ToUpper(prefix)
+}
+
+// RangeURL returns the URL of the Pwned Passwords range API for the prefix,
+// normalized to uppercase. It returns ErrorInvalidPrefix if the prefix is not
+// exactly 5 hex characters, as requesting it would return an empty result
+// that looks like no password with the prefix was breached.
+func RangeURL(prefix string) (string, error) {
+	normalizedPrefix, err := normalizePrefix(prefix)
+	if err != nil {
+		return "", err
+	}
+
+	return DefaultBaseURL + string(normalizedPrefix), nil
 }
 
 // DefaultUserAgent is the User-Agent header sent to the Pwned Passwords API if
 // it has not been explicitly set.
 var DefaultUserAgent = "https://github.com/supabase/hibp"
 
+// DefaultMaxEntries is the number of lines parsed from a single response when
+// PwnedClient.MaxEntries is not set. Real responses contain around 1000 lines,
+// so this is never reached legitimately.
+const DefaultMaxEntries = 100_000
+
+// DefaultMaxResponseBytes is the maximum size of a single response when
+// PwnedClient.MaxResponseBytes is not set. Real responses are around 40KB, or
+// somewhat larger with padding.
+const DefaultMaxResponseBytes = 4 << 20
+
 // PwnedCache is the interface with which you can cache responses from the
-// Pwned Passwords API.
+// Pwned Passwords API. As breach data is updated over time, implementations
+// should expire entries after some time, such as LRUCache.TTL does.
 type PwnedCache interface {
 	// Add records the provided prefix and suffixes in the cache.
 	Add(ctx context.Context, prefix []byte, suffixes [][]byte) error
@@ -31,36 +95,459 @@ type PwnedCache interface {
 	Contains(ctx context.Context, prefix, suffix []byte) (bool, error)
 }
 
+// KnownPwnedCache is optionally implemented by PwnedCache implementations that
+// record the complete set of suffixes of each prefix added, which allows
+// PwnedClient to answer that a password is not pwned without a request.
+type KnownPwnedCache interface {
+	PwnedCache
+
+	// ContainsKnown is like Contains, but also reports whether the
+	// complete set of suffixes of the prefix is recorded, in which case a
+	// false contains means the suffix is definitely absent.
+	ContainsKnown(ctx context.Context, prefix, suffix []byte) (contains, known bool, err error)
+}
+
+// CountingPwnedCache is optionally implemented by KnownPwnedCache
+// implementations that also record occurrence counts, which allows PwnedClient
+// to answer CheckCount and Lookup with the count without a request. When the
+// Cache implements it, PwnedClient records responses with AddCounts instead of
+// Add.
+type CountingPwnedCache interface {
+	KnownPwnedCache
+
+	// AddCounts is like Add, but also records the raw occurrence count
+	// of each of the suffixes.
+	AddCounts(ctx context.Context, prefix []byte, suffixes, counts [][]byte) error
+
+	// Count returns the occurrence count of the suffix, or 0 if it is not
+	// recorded for the prefix. The returned ok is false if the cache
+	// cannot answer, such as when the prefix is missing.
+	Count(ctx context.Context, prefix, suffix []byte) (count int, ok bool, err error)
+}
+
+// RevalidatingPwnedCache is optionally implemented by PwnedCache
+// implementations that record the ETag of responses, so that PwnedClient can
+// revalidate expired prefixes with a conditional request. If the Pwned
+// Passwords API responds with 304 Not Modified, the recorded suffixes are
+// reused without downloading or parsing them again. When the Cache implements
+// it, PwnedClient records responses with AddETag.
+type RevalidatingPwnedCache interface {
+	PwnedCache
+
+	// AddETag is like Add, but also records the raw occurrence count of
+	// each of the suffixes and the ETag of the response they came from,
+	// which may be empty.
+	AddETag(ctx context.Context, prefix []byte, suffixes, counts [][]byte, etag string) error
+
+	// Stale returns copies of the suffixes and counts recorded for the
+	// prefix along with their ETag, even if they have expired. The ETag
+	// is empty if the prefix cannot be revalidated.
+	Stale(ctx context.Context, prefix []byte) (suffixes, counts [][]byte, etag string, err error)
+
+	// Refresh marks the suffixes of the prefix as fresh again, after the
+	// Pwned Passwords API confirmed they have not changed.
+	Refresh(ctx context.Context, prefix []byte) error
+}
+
+// CacheInspector is optionally implemented by PwnedCache implementations that
+// can list their contents, such as to report how warm the cache is on an admin
+// endpoint. PwnedClient never uses it.
+type CacheInspector interface {
+	// Prefixes returns the prefixes held in the cache, sorted.
+	Prefixes(ctx context.Context) ([]CachedPrefix, error)
+}
+
+// CachedPrefix describes a prefix held in a cache, as listed by
+// CacheInspector.
+type CachedPrefix struct {
+	// Prefix is the hash prefix.
+	Prefix string
+
+	// Suffixes is the number of suffixes recorded for the prefix.
+	Suffixes int
+
+	// Added is when the suffixes were added, or last refreshed.
+	Added time.Time
+
+	// Expired is set if the suffixes are no longer used to answer checks,
+	// but are still held, such as to be revalidated.
+	Expired bool
+}
+
 // PwnedClient can be used to send requests to the Pwned Passwords API. Zero
 // value is safe to use, though it is highly recommended you configure the
 // UserAgent property per the HaveIBeenPwned.org API rules.
 type PwnedClient struct {
-	// UserAgent is sent as the User-Agent header to HTTP requests.
+	// Mode selects the hash function used to check passwords, SHA-1 by
+	// default. Use separate Cache instances for clients in different
+	// modes, as the prefixes of both hash functions overlap.
+	Mode Mode
+
+	// Hasher, when set, computes the hex hash of passwords instead of the
+	// hash function of the Mode, such as to transform passwords before
+	// hashing or to use a deterministic fake in tests. It must return a
+	// hash of the length used by the Mode (40 hex characters for SHA-1, 32
+	// for NTLM), otherwise checks fail with ErrorInvalidHash. It is not
+	// used by CheckHash and CheckNTLMHash. CheckBytes has to convert the
+	// password to a string to pass it to Hasher.
+	Hasher func(password string) (hexUpper string)
+
+	// UserAgent is sent as the User-Agent header to HTTP requests. It can
+	// be overridden per call with ContextWithUserAgent.
 	UserAgent string
 
+	// StrictUserAgent makes requests fail with ErrMissingUserAgent unless
+	// a User-Agent other than DefaultUserAgent is set, with UserAgent or
+	// ContextWithUserAgent. The Pwned Passwords API requires a descriptive
+	// User-Agent, and production traffic with the default may be
+	// throttled.
+	StrictUserAgent bool
+
 	// Cache, when set, will be used to cache and lookup results.
 	Cache PwnedCache
 
-	// HTTP allows you to override the HTTP client used. If not set http.DefaultClient is used.
+	// AuditSink, when set, records the outcome of every successful check
+	// before it is returned.
+	AuditSink AuditSink
+
+	// AuditSinkFatal makes checks fail with the error returned by
+	// AuditSink. Otherwise errors from AuditSink are ignored.
+	AuditSinkFatal bool
+
+	// Padding, when set, asks the Pwned Passwords API to pad responses with
+	// random zero-count lines using the Add-Padding header, so that the
+	// size of a response does not reveal which prefix was queried. Padding
+	// lines are ignored when parsing.
+	Padding bool
+
+	// RequestIDHeader, when set, is the name of a header (such as
+	// X-Request-ID) sent with each request holding the request ID from
+	// ContextWithRequestID, or a random UUID if none was set.
+	RequestIDHeader string
+
+	// Headers, when set, are added to each request, such as
+	// authentication tokens for a proxy or gateway. They replace headers
+	// of the same name set by the client, including User-Agent. Names must
+	// be in canonical form, as added by http.Header.Set.
+	Headers http.Header
+
+	// RequestHook, when set, is called with each request right before it
+	// is sent, after all other headers have been set, allowing it to be
+	// modified (such as to sign it). A returned error fails the check.
+	RequestHook func(req *http.Request) error
+
+	// ValidatePrefixMatch makes checks fail with ErrorPrefixMismatch if
+	// the final URL that served a response (after any redirects) is not
+	// for the requested prefix, guarding against misrouting proxies.
+	ValidatePrefixMatch bool
+
+	// MaxEntries limits the number of lines parsed from a single response,
+	// protecting against pathological responses that would otherwise tie
+	// up the CPU. If 0, DefaultMaxEntries is used. A negative value
+	// disables the limit.
+	MaxEntries int
+
+	// MaxResponseBytes limits the size of a single response (after
+	// decompression), protecting against unbounded memory use when pointed
+	// at the wrong endpoint. Larger responses fail with
+	// ErrorResponseTooLarge. If 0, DefaultMaxResponseBytes is used. A
+	// negative value disables the limit.
+	MaxResponseBytes int64
+
+	// CoalesceWindow, when positive, delays sending a request for a new
+	// prefix by this duration so that checks sharing the prefix arriving
+	// shortly after join it. This trades a little latency for fewer
+	// requests during bursts. Zero sends requests immediately.
+	CoalesceWindow time.Duration
+
+	// OnServerDate, when set, is called with the prefix and the server
+	// time from the Date header of the response each time a result from
+	// the Pwned Passwords API is used, such as to record when a breach
+	// determination was made. It is not called for results from the Cache
+	// or if the response has no valid Date header.
+	OnServerDate func(prefix string, date time.Time)
+
+	// OnEmptyRange, when set, is called with the prefix and how the
+	// response was parsed each time a successful response from the Pwned
+	// Passwords API yields no suffixes, whether it was empty, all padding
+	// or unparseable (in which case the check also fails with
+	// ErrorMalformedResponse). Real ranges are never empty, so this tells
+	// middleboxes mangling responses apart from clean prefixes.
+	OnEmptyRange func(prefix string, diag ResponseDiagnostics)
+
+	// MaxRetries is the number of times a request is retried after a 429
+	// Too Many Requests or 503 Service Unavailable response. Zero disables
+	// retries.
+	MaxRetries int
+
+	// Backoff computes the delay between retries. The Retry-After header
+	// of 429 responses takes precedence. If not set, an exponential
+	// backoff starting at 250ms and capped at 10s is used.
+	Backoff Backoff
+
+	// Logf, when set, receives debug logs of the prefixes queried, cache
+	// decisions, request attempts and retries. Suffixes and passwords are
+	// never logged, so the logs are safe to keep in staging.
+	Logf func(format string, args ...any)
+
+	// BreakerThreshold, when positive, enables a circuit breaker that stops
+	// sending requests after this many consecutive transport errors or
+	// 5xx responses, failing checks with ErrorCircuitOpen instead (or
+	// not pwned with CheckFailOpen). After BreakerCooldown a single probe
+	// request is let through, and the breaker closes again if it
+	// succeeds.
+	BreakerThreshold int
+
+	// BreakerCooldown is how long the circuit breaker stays open before
+	// probing. If not set, DefaultBreakerCooldown is used.
+	BreakerCooldown time.Duration
+
+	// MinEntries, when positive, is the minimum number of valid lines a
+	// successful response must contain to be trusted. Responses with fewer
+	// lines fail with ErrorTooFewEntries, guarding against truncated
+	// responses from flaky mirrors. Zero disables the check.
+	MinEntries int
+
+	// Timeout, when positive, limits how long a check may take, in
+	// addition to any deadline of the passed context. Checks exceeding it
+	// fail with context.DeadlineExceeded. Requests shared by concurrent
+	// checks of the same prefix are limited to the same duration from
+	// when they were first sent.
+	Timeout time.Duration
+
+	// ReuseWindow, when positive, is how long the parsed result of a
+	// successful request is reused by checks of the same prefix after the
+	// request completed, so that checks arriving shortly after one another
+	// without overlapping send a single request. Unlike the Cache, results
+	// are held in memory as they were received, and reuses are reported as
+	// coalesced. Checks with a context from ContextWithCacheBypass never
+	// reuse results. Zero only shares requests still in flight.
+	ReuseWindow time.Duration
+
+	// DisableSingleFlight makes every check send its own request instead
+	// of joining a request for the same prefix already in flight, such as
+	// to benchmark the latency of individual requests. Coalescing is what
+	// keeps bursts of checks of popular prefixes cheap and within the
+	// fair use limits of the API, so disabling it multiplies requests
+	// under load, though no check then waits on a request started by
+	// another.
+	DisableSingleFlight bool
+
+	// MaxConcurrency, when positive, limits the number of requests for
+	// distinct prefixes in flight at once, so that bursts of checks do
+	// not exceed the fair use limits of the Pwned Passwords API. Further
+	// requests wait until others complete. Checks of a prefix already in
+	// flight join its request without waiting. It must not be changed
+	// after the first check.
+	MaxConcurrency int
+
+	// OnRequest, when set, is called after each request to the Pwned
+	// Passwords API (including each retry) with the prefix, the time
+	// taken to receive and parse the response, the status code (0 if no
+	// response was received) and the error, if any.
+	OnRequest func(prefix string, dur time.Duration, status int, err error)
+
+	// OnCoalesced, when set, is called with the prefix each time a check
+	// joins a request for the prefix already in flight instead of sending
+	// a new one.
+	OnCoalesced func(prefix string)
+
+	// OnCacheHit and OnCacheMiss, when set, are called with the prefix
+	// each time a check is answered from the Cache or not, respectively.
+	OnCacheHit  func(prefix string)
+	OnCacheMiss func(prefix string)
+
+	// StartSpan, when set, is called at the start of each check with the
+	// hash prefix to start a tracing span, such as with OpenTelemetry. The
+	// returned context is used for the check, so that trace propagation
+	// headers can be added to the request, and the returned function is
+	// called with the result of the check to end the span. Checks joining
+	// a request already in flight share the request of the first check.
+	StartSpan func(ctx context.Context, prefix string) (context.Context, func(result SpanResult))
+
+	// BaseURL, when set, is the base URL of the range endpoint to use
+	// instead of DefaultBaseURL, such as an internal mirror of the Pwned
+	// Passwords API. The prefix is appended to it, with or without a
+	// trailing slash.
+	BaseURL string
+
+	// HTTP allows you to override the HTTP client used. If not set a
+	// client using DefaultTransport is used, configured with the transport
+	// settings below.
 	HTTP interface {
 		Do(*http.Request) (*http.Response, error)
 	}
 
+	// ConnectTimeout, when HTTP is not set, limits how long establishing a
+	// connection may take, so that unreachable endpoints fail fast.
+	ConnectTimeout time.Duration
+
+	// FallbackDelay, when HTTP is not set, is how long to wait for an
+	// IPv6 connection before also trying IPv4 on dual-stack hosts ("Happy
+	// Eyeballs"), so that a flaky IPv6 path does not stall requests. Zero
+	// uses the net.Dialer default of 300ms, and a negative value disables
+	// the fallback.
+	FallbackDelay time.Duration
+
+	// IPv4Only, when HTTP is not set, makes connections only over IPv4,
+	// for networks where IPv6 is broken altogether.
+	IPv4Only bool
+
+	// ResponseHeaderTimeout, when HTTP is not set, limits how long to wait
+	// for the response headers after the request has been sent.
+	ResponseHeaderTimeout time.Duration
+
+	// Proxy, when HTTP is not set, selects the proxy for each request,
+	// such as http.ProxyURL for an egress proxy, instead of the proxy
+	// from the environment variables.
+	Proxy func(*http.Request) (*url.URL, error)
+
+	// RootCAs, when HTTP is not set, is the set of certificate authorities
+	// trusted to verify servers instead of the system trust store, such as
+	// the private CA of an internal mirror set as BaseURL.
+	RootCAs *x509.CertPool
+
+	// PinnedPublicKeys, when HTTP is not set, only trusts servers whose
+	// verified certificate chain contains one of these public keys, each
+	// the base64-encoded SHA-256 hash of a DER-encoded SubjectPublicKeyInfo
+	// (as with curl's --pinnedpubkey without the "sha256//" prefix).
+	// Connections to other servers fail with ErrCertificateNotPinned. Pin
+	// a backup key too, as certificates of the Pwned Passwords API are
+	// rotated.
+	PinnedPublicKeys []string
+
+	// defaultHTTP is the client built from the transport settings, used
+	// when HTTP is not set.
+	defaultHTTP     *http.Client
+	defaultHTTPOnce sync.Once
+
+	// breaker holds the state of the circuit breaker.
+	breaker circuitBreaker
+
+	// stats holds the counters returned by Stats.
+	stats clientStats
+
+	// sem limits the number of requests in flight when MaxConcurrency is
+	// set. It is created on first use.
+	sem chan struct{}
+
 	// lock is used to synchronize access when needed.
 	lock sync.Mutex
 
+	// closed is set once Close has been called.
+	closed bool
+
 	// requests holds a map of prefixes. Before a password is checked, this
 	// map is consulted to see if there's already an in-flight request for
 	// the prefix. If it is, the refcount box is reused.
-	requests map[string]*refcountBox[func() (*http.Response, error)]
+	requests map[string]*refcountBox[*pwnedRequest]
+
+	// requestSeq numbers requests made with DisableSingleFlight set.
+	requestSeq uint64
+}
+
+// pwnedRequest is an in-flight request to the Pwned Passwords API, shared by
+// all callers checking passwords with the same prefix.
+type pwnedRequest struct {
+	// done is closed when the request completes.
+	done chan struct{}
+
+	// cancel cancels the request. It is called when no callers are
+	// waiting on the request anymore.
+	cancel context.CancelFunc
+
+	res *http.Response
+	err error
+}
+
+// completed reports whether the request has completed.
+func (r *pwnedRequest) completed() bool {
+	select {
+	case <-r.done:
+		return true
+
+	default:
+		return false
+	}
+}
+
+// Wait blocks until the request completes or the context is canceled,
+// whichever comes first.
+func (r *pwnedRequest) Wait(ctx context.Context) (*http.Response, error) {
+	select {
+	case <-r.done:
+		return r.res, r.err
+
+	case <-ctx.Done():
+		select {
+		case <-r.done:
+			// request completed at the same time
+			return r.res, r.err
+
+		default:
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// ResponseDiagnostics describes how a response from the Pwned Passwords API
+// was parsed.
+type ResponseDiagnostics struct {
+	// Bytes is the number of bytes read, after decompression.
+	Bytes int64
+
+	// Lines is the number of non-empty lines, valid or not.
+	Lines int
+
+	// Entries is the number of valid lines, including padding.
+	Entries int
+
+	// Suffixes is the number of suffixes parsed, excluding padding.
+	Suffixes int
 }
 
 // pwnedResultBuffer is used on res.Body to hold the original response body
 // from the Pwned Passwords API as well as the parsed suffixes.
 type pwnedResultBuffer struct {
+	// Mode selects the URL requested and the format of lines parsed.
+	Mode Mode
+
+	// MaxEntries, when positive, is the maximum number of lines parsed.
+	MaxEntries int
+
+	// SortSuffixes makes ParseFrom sort the suffixes (and their counts) if
+	// they are not already sorted, so that lookups use a binary search.
+	SortSuffixes bool
+
 	Buffer         *bytes.Buffer
 	SuffixesSorted bool
 	Suffixes       [][]byte
+
+	// Counts holds the raw occurrence count for each of the Suffixes.
+	Counts [][]byte
+
+	// Entries is the number of valid lines parsed, including padding.
+	Entries int
+
+	// lines is the number of non-empty lines parsed, valid or not.
+	lines int
+
+	// FullyFetched is set once a response was parsed to its end with
+	// every line valid, meaning Suffixes is the complete set for the
+	// prefix. An empty or all-padding response then reliably means no
+	// suffix of the prefix is pwned, rather than a response that could
+	// not be parsed.
+	FullyFetched bool
+
+	// Date is the server time from the response's Date header, if any.
+	Date time.Time
+
+	// ETag is the ETag header of the response, if any.
+	ETag string
+
+	// pooledSuffixes, when set, is the suffixesPool entry that Suffixes
+	// was taken from.
+	pooledSuffixes *[][]byte
 }
 
 func (b *pwnedResultBuffer) Read(into []byte) (int, error) {
@@ -91,46 +578,171 @@ func (b *pwnedResultBuffer) Close() error {
 // > 0136E006E24E7D152139815FB0FC6A50B15:2
 // > ...
 // > ```
-var pwnedLinePattern = regexp.MustCompile(`^([0-9A-F]{35}):([0-9]+)\s*$`)
+//
+// Lowercase suffixes, as returned by some mirrors and proxies, are accepted
+// too and normalized to uppercase when parsing. Lines are trimmed of
+// surrounding whitespace before matching.
+var pwnedLinePattern = regexp.MustCompile(`^([0-9A-Fa-f]{35}):([0-9]+)$`)
 
-// Parse parses the password suffixes from the buffer.
-func (buf *pwnedResultBuffer) Parse() {
-	defer buf.Buffer.Reset()
+// maxLineLength is the maximum length of a line parsed by ParseFrom. Valid
+// lines are far shorter.
+const maxLineLength = 64 * 1024
 
+// ParseFrom parses the password suffixes while reading them from r line by
+// line, so that the whole response is never held in memory. The Buffer is only
+// used to read into. It returns ErrorTooManyEntries if r contains more than
+// MaxEntries lines, and bufio.ErrTooLong if a line is longer than 64KB.
+func (buf *pwnedResultBuffer) ParseFrom(r io.Reader) error {
 	buf.SuffixesSorted = true
 
-	running := true
+	buf.Buffer.Reset()
 
-	for running {
-		line, err := buf.Buffer.ReadBytes('\n')
-		if err != nil {
-			// err can only be io.EOF here, Buffer does not return
-			// any other errors
-			running = false
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(buf.Buffer.AvailableBuffer(), maxLineLength)
+	scanner.Split(scanLines)
+
+	for scanner.Scan() {
+		if err := buf.parseLine(scanner.Bytes()); err != nil {
+			return err
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	buf.finishParse()
+
+	return nil
+}
+
+// scanLines is a bufio.SplitFunc splitting lines, treating LF, CRLF and bare CR
+// as line endings.
+func scanLines(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	end := bytes.IndexAny(data, "\r\n")
+	if end < 0 {
+		if atEOF && len(data) > 0 {
+			return len(data), data, nil
 		}
 
-		matches := pwnedLinePattern.FindSubmatch(line)
-		if matches == nil {
-			continue
+		// request more data
+		return 0, nil, nil
+	}
+
+	next := end + 1
+	if data[end] == '\r' {
+		if next == len(data) && !atEOF {
+			// a LF may follow
+			return 0, nil, nil
 		}
 
-		suffix := matches[1]
-		occurrence := matches[2]
+		if next < len(data) && data[next] == '\n' {
+			next += 1
+		}
+	}
 
-		if buf.SuffixesSorted && len(buf.Suffixes) > 0 {
-			if bytes.Compare(buf.Suffixes[len(buf.Suffixes)-1], suffix) >= 0 {
-				buf.SuffixesSorted = false
-			}
+	return next, data[:end], nil
+}
+
+// parseLine parses a single line of a response, appending its suffix and count
+// if it is valid and not padding.
+func (buf *pwnedResultBuffer) parseLine(line []byte) error {
+	// mirrors may pad lines with whitespace or leave stray line endings
+	line = bytes.TrimSpace(line)
+	if len(line) == 0 {
+		return nil
+	}
+
+	buf.lines += 1
+	if buf.MaxEntries > 0 && buf.lines > buf.MaxEntries {
+		return &ErrorTooManyEntries{
+			Limit: buf.MaxEntries,
+		}
+	}
+
+	matches := buf.Mode.linePattern().FindSubmatch(line)
+	if matches == nil {
+		return nil
+	}
+
+	buf.Entries += 1
+
+	suffix := matches[1]
+	occurrence := matches[2]
+
+	// line points into the buffer which is reused, so it can be modified
+	// in place
+	for i, ch := range suffix {
+		if ch >= 'a' && ch <= 'f' {
+			suffix[i] = ch - 'a' + 'A'
 		}
+	}
 
-		if len(occurrence) > 1 || (len(occurrence) == 1 && occurrence[0] != '0') {
-			buf.Suffixes = append(buf.Suffixes, suffix)
+	if buf.SuffixesSorted && len(buf.Suffixes) > 0 {
+		if bytes.Compare(buf.Suffixes[len(buf.Suffixes)-1], suffix) >= 0 {
+			buf.SuffixesSorted = false
 		}
 	}
+
+	if len(occurrence) > 1 || (len(occurrence) == 1 && occurrence[0] != '0') {
+		// line points into the buffer which is reused, so the suffix
+		// and count need to be copied
+		entry := bytes.Clone(line[:len(suffix)+1+len(occurrence)])
+
+		buf.Suffixes = append(buf.Suffixes, entry[:len(suffix):len(suffix)])
+		buf.Counts = append(buf.Counts, entry[len(suffix)+1:])
+	}
+
+	return nil
+}
+
+// finishParse sorts the suffixes if requested with SortSuffixes and needed.
+func (buf *pwnedResultBuffer) finishParse() {
+	buf.FullyFetched = buf.Entries == buf.lines
+
+	if !buf.SuffixesSorted && buf.SortSuffixes {
+		sort.Sort(suffixesByValue{buf})
+		buf.SuffixesSorted = true
+	}
+}
+
+// suffixesByValue sorts the suffixes of a pwnedResultBuffer along with their
+// counts.
+type suffixesByValue struct {
+	buf *pwnedResultBuffer
+}
+
+func (s suffixesByValue) Len() int {
+	return len(s.buf.Suffixes)
+}
+
+func (s suffixesByValue) Less(i, j int) bool {
+	return bytes.Compare(s.buf.Suffixes[i], s.buf.Suffixes[j]) < 0
+}
+
+func (s suffixesByValue) Swap(i, j int) {
+	s.buf.Suffixes[i], s.buf.Suffixes[j] = s.buf.Suffixes[j], s.buf.Suffixes[i]
+	s.buf.Counts[i], s.buf.Counts[j] = s.buf.Counts[j], s.buf.Counts[i]
 }
 
 // Lookup searches through the parsed suffixes.
 func (buf *pwnedResultBuffer) Lookup(suffix []byte) bool {
+	return buf.Index(suffix) >= 0
+}
+
+// LookupCount returns the occurrence count of the suffix, or 0 if it was not
+// found.
+func (buf *pwnedResultBuffer) LookupCount(suffix []byte) int {
+	if index := buf.Index(suffix); index >= 0 {
+		return parseCount(buf.Counts[index])
+	}
+
+	return 0
+}
+
+// Index returns the position of the suffix in the parsed suffixes, or -1 if
+// it was not found.
+func (buf *pwnedResultBuffer) Index(suffix []byte) int {
 	if !buf.SuffixesSorted {
 		// Because the Pwned Passwords API does not explicitly claim
 		// that the returned suffixes are sorted (though in practice
@@ -138,40 +750,72 @@ func (buf *pwnedResultBuffer) Lookup(suffix []byte) bool {
 		// they're not sorted, the quickest way is to loop through all
 		// suffixes.
 
-		for _, s := range buf.Suffixes {
+		for i, s := range buf.Suffixes {
 			if bytes.Equal(s, suffix) {
-				return true
+				return i
 			}
 		}
 
-		return false
+		return -1
 	}
 
 	// Suffixes are sorted, so we can use binary search to quickly find
 	// whether the suffix is in buf.Suffixes.
 
-	suffixBytes := []byte(suffix)
-
 	index := sort.Search(len(buf.Suffixes), func(i int) bool {
-		return bytes.Compare(buf.Suffixes[i], suffixBytes) >= 0
+		return bytes.Compare(buf.Suffixes[i], suffix) >= 0
 	})
 
-	if index < len(buf.Suffixes) {
-		return bytes.Equal(suffixBytes, buf.Suffixes[index])
+	if index < len(buf.Suffixes) && bytes.Equal(suffix, buf.Suffixes[index]) {
+		return index
+	}
+
+	return -1
+}
+
+// baseURL returns the base URL of the range endpoint, always ending in a slash.
+func (c *PwnedClient) baseURL() string {
+	if c.BaseURL == "" {
+		return DefaultBaseURL
+	}
+
+	if strings.HasSuffix(c.BaseURL, "/") {
+		return c.BaseURL
 	}
 
-	return false
+	return c.BaseURL + "/"
 }
 
 // doRequest finally sends a request to the Pwned Passwords API and uses buf to
 // read and parse the result into.
-func (c *PwnedClient) doRequest(ctx context.Context, buf *pwnedResultBuffer, prefix []byte) (*http.Response, error) {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, PwnedPasswordsURL(string(prefix)), nil)
+func (c *PwnedClient) doRequest(ctx context.Context, buf *pwnedResultBuffer, prefix []byte) (res *http.Response, err error) {
+	if c.OnRequest != nil {
+		start := time.Now()
+
+		defer func() {
+			status := 0
+			if res != nil {
+				status = res.StatusCode
+			}
+
+			c.OnRequest(string(prefix), time.Since(start), status, err)
+		}()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, buf.Mode.url(c.baseURL(), string(prefix)), nil)
 	if err != nil {
 		return nil, err
 	}
 
-	userAgent := c.UserAgent
+	userAgent := userAgentFromContext(ctx)
+
+	if userAgent == "" {
+		userAgent = c.UserAgent
+	}
+
+	if c.StrictUserAgent && (userAgent == "" || userAgent == DefaultUserAgent) {
+		return nil, ErrMissingUserAgent
+	}
 
 	if userAgent == "" {
 		userAgent = DefaultUserAgent
@@ -181,129 +825,895 @@ func (c *PwnedClient) doRequest(ctx context.Context, buf *pwnedResultBuffer, pre
 		req.Header.Set("User-Agent", userAgent)
 	}
 
-	client := c.HTTP
-	if client == nil {
-		client = http.DefaultClient
+	// setting this explicitly disables the transparent decompression of
+	// http.Transport, which does not apply to custom HTTP clients anyway
+	req.Header.Set("Accept-Encoding", "gzip")
+
+	if c.Padding {
+		req.Header.Set("Add-Padding", "true")
+	}
+
+	if c.RequestIDHeader != "" {
+		req.Header.Set(c.RequestIDHeader, requestID(ctx))
+	}
+
+	cache := c.cacheFor(buf.Mode)
+
+	revalidatingCache, _ := cache.(RevalidatingPwnedCache)
+
+	var staleSuffixes, staleCounts [][]byte
+	var staleETag string
+
+	if revalidatingCache != nil {
+		staleSuffixes, staleCounts, staleETag, err = revalidatingCache.Stale(ctx, prefix)
+		if err != nil {
+			return nil, err
+		}
+
+		if staleETag != "" {
+			req.Header.Set("If-None-Match", staleETag)
+		}
+	}
+
+	for name, values := range c.Headers {
+		req.Header[name] = slices.Clone(values)
+	}
+
+	if c.RequestHook != nil {
+		if err := c.RequestHook(req); err != nil {
+			return nil, err
+		}
 	}
 
-	res, err := client.Do(req)
+	c.stats.fetches.Add(1)
+
+	res, err = c.httpClient().Do(req)
 	if err != nil {
-		return res, err
+		return res, &ErrorTransport{
+			Prefix: string(prefix),
+			URL:    req.URL.String(),
+			Err:    err,
+		}
 	}
 
 	originalBody := res.Body
 	defer originalBody.Close()
 
 	if res.StatusCode == http.StatusOK {
-		_, err = buf.Buffer.ReadFrom(originalBody)
-		if err != nil {
+		if c.ValidatePrefixMatch && !responseMatchesPrefix(res, prefix) {
+			return res, &ErrorPrefixMismatch{
+				Prefix:   string(prefix),
+				Response: res,
+			}
+		}
+
+		if contentType := res.Header.Get("Content-Type"); !isTextContentType(contentType) {
+			return res, &ErrorUnexpectedContentType{
+				ContentType: contentType,
+				Response:    res,
+			}
+		}
+
+		var body io.Reader = originalBody
+
+		if strings.EqualFold(res.Header.Get("Content-Encoding"), "gzip") {
+			reader, err := acquireGzipReader(originalBody)
+			if err != nil {
+				return res, err
+			}
+
+			defer releaseGzipReader(reader)
+
+			body = reader
+		}
+
+		maxResponseBytes := c.maxResponseBytes()
+
+		var limited *io.LimitedReader
+		if maxResponseBytes > 0 {
+			// read one more byte to tell whether the limit was
+			// exceeded
+			limited = &io.LimitedReader{
+				R: body,
+				N: maxResponseBytes + 1,
+			}
+
+			body = limited
+		}
+
+		counted := &countingReader{
+			r: body,
+		}
+
+		if err := buf.ParseFrom(counted); err != nil {
 			return res, err
 		}
 
-		defer buf.Buffer.Reset()
+		if c.OnEmptyRange != nil && len(buf.Suffixes) == 0 {
+			c.OnEmptyRange(string(prefix), ResponseDiagnostics{
+				Bytes:    counted.n,
+				Lines:    buf.lines,
+				Entries:  buf.Entries,
+				Suffixes: len(buf.Suffixes),
+			})
+		}
+
+		// a genuinely empty range has no lines at all, so lines that
+		// are all invalid mean something other than the Pwned
+		// Passwords API responded
+		if buf.lines > 0 && buf.Entries == 0 {
+			return res, &ErrorMalformedResponse{
+				Lines:    buf.lines,
+				Bytes:    counted.n,
+				Response: res,
+			}
+		}
+
+		if limited != nil && limited.N == 0 {
+			return res, &ErrorResponseTooLarge{
+				Limit: maxResponseBytes,
+			}
+		}
+
+		if c.MinEntries > 0 && buf.Entries < c.MinEntries {
+			return res, &ErrorTooFewEntries{
+				Minimum: c.MinEntries,
+				Entries: buf.Entries,
+			}
+		}
+
+		if date, err := http.ParseTime(res.Header.Get("Date")); err == nil {
+			buf.Date = date
+		}
+
+		buf.ETag = res.Header.Get("ETag")
+
+		// caches that answer that a suffix is absent, or reuse
+		// recorded suffixes after revalidating them, must only
+		// record ranges that were valid throughout, while others
+		// are only worth recording if there are any suffixes
+		_, known := cache.(KnownPwnedCache)
+
+		record := len(buf.Suffixes) > 0
+		if known || revalidatingCache != nil {
+			record = buf.FullyFetched
+		}
+
+		if cache != nil && record {
+			// the response was already received in full, so record
+			// it even if all callers have stopped waiting for it in
+			// the meantime
+			ctx := context.WithoutCancel(ctx)
+
+			if revalidatingCache != nil {
+				err = revalidatingCache.AddETag(ctx, prefix, buf.Suffixes, buf.Counts, buf.ETag)
+			} else if countingCache, ok := cache.(CountingPwnedCache); ok {
+				err = countingCache.AddCounts(ctx, prefix, buf.Suffixes, buf.Counts)
+			} else {
+				err = cache.Add(ctx, prefix, buf.Suffixes)
+			}
 
-		buf.Parse()
-		if c.Cache != nil && len(buf.Suffixes) > 0 {
-			if err := c.Cache.Add(ctx, prefix, buf.Suffixes); err != nil {
+			if err != nil {
 				return res, err
 			}
 		}
 
 		res.Body = buf
+	} else if res.StatusCode == http.StatusNotModified && staleETag != "" {
+		// the recorded suffixes are still current, so use them as if
+		// they had been parsed from the response
+		buf.Suffixes = append(buf.Suffixes, staleSuffixes...)
+		buf.Counts = append(buf.Counts, staleCounts...)
+		buf.Entries = len(staleSuffixes)
+		buf.SuffixesSorted = true
+		buf.FullyFetched = true
+
+		if date, err := http.ParseTime(res.Header.Get("Date")); err == nil {
+			buf.Date = date
+		}
+
+		buf.ETag = staleETag
+
+		if err := revalidatingCache.Refresh(context.WithoutCancel(ctx), prefix); err != nil {
+			return res, err
+		}
+
+		res.Body = buf
+	} else {
+		// the original body is closed on return, so keep the start
+		// of it for ErrorUnexpectedResponse
+		res.Body = &snippetBody{
+			snippet: readBodySnippet(originalBody),
+		}
 	}
 
 	return res, nil
 }
 
+// isTextContentType reports whether the Content-Type of a response is text, as
+// expected from the Pwned Passwords API. A missing Content-Type is accepted.
+func isTextContentType(contentType string) bool {
+	if contentType == "" {
+		return true
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	return strings.HasPrefix(mediaType, "text/") && mediaType != "text/html"
+}
+
+// responseMatchesPrefix reports whether the response was served from a URL
+// whose last path segment is the prefix.
+func responseMatchesPrefix(res *http.Response, prefix []byte) bool {
+	if res.Request == nil || res.Request.URL == nil {
+		return false
+	}
+
+	return strings.EqualFold(path.Base(res.Request.URL.Path), string(prefix))
+}
+
 // Check uses the Pwned Passwords API to check if the provided password is
 // found in a breach. If two concurrent calls are made with passwords that
 // share the same SHA1 prefix, only a single request will be sent. You can
-// cancel the context to cancel long-running requests.
+// cancel the context to stop waiting for the result, and the shared request is
+// canceled once no callers are waiting on it anymore. If the context is
+// already done, its error is returned without any hashing or cache lookups.
 //
-// Unexpected HTTPS responses will return ErrorUnexpectedResponse.
+// Unexpected HTTPS responses will return ErrorUnexpectedResponse, except for
+// 429 Too Many Requests which returns ErrorRateLimited.
 func (c *PwnedClient) Check(ctx context.Context, password string) (bool, error) {
 	if ctx == nil {
 		ctx = context.Background()
 	}
 
-	sum := sha1.Sum([]byte(password))
-	hexsum := []byte(strings.ToUpper(hex.EncodeToString(sum[:])))
-	prefix := hexsum[:5]
-	suffix := hexsum[5:]
+	// fail fast without hashing or consulting the cache
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	prefix, suffix, err := c.hash(password)
+	if err != nil {
+		return false, err
+	}
+
+	result, err := c.lookup(ctx, c.Mode, prefix, suffix, true)
+
+	return result.Pwned, err
+}
+
+// CheckBytes is like Check, but for a password held in a byte slice, such as
+// one that is zeroed out after use. Unless Hasher is set, the password is
+// hashed directly from the slice, so that no copies of it outlive the call.
+// The caller remains responsible for wiping the slice.
+func (c *PwnedClient) CheckBytes(ctx context.Context, password []byte) (bool, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	var prefix, suffix []byte
+
+	if c.Hasher != nil {
+		var err error
 
-	if c.Cache != nil {
-		contains, err := c.Cache.Contains(ctx, prefix, suffix)
+		prefix, suffix, err = c.hash(string(password))
 		if err != nil {
-			return contains, err
+			return false, err
 		}
+	} else {
+		prefix, suffix = c.Mode.hashBytes(password)
+	}
 
-		if contains {
-			return true, nil
-		}
+	result, err := c.lookup(ctx, c.Mode, prefix, suffix, true)
+
+	return result.Pwned, err
+}
+
+// Result is the detailed result of checking a password with Lookup.
+type Result struct {
+	// Pwned is true if the password was found in a breach.
+	Pwned bool
+
+	// Count is the number of times the password was found in breaches. It
+	// is 0 if the result came from a Cache that does not implement
+	// CountingPwnedCache.
+	Count int
+
+	// FromCache is true if the result came from the Cache without a
+	// request to the Pwned Passwords API.
+	FromCache bool
+
+	// Prefix is the hash prefix that was queried.
+	Prefix string
+
+	// ETag is the ETag of the response of the Pwned Passwords API the
+	// result came from, if any. It is empty for results from the Cache.
+	ETag string
+}
+
+// Lookup is like Check, but returns a Result with the occurrence count of the
+// password and where the result came from, such as to show how often a
+// password appeared in breaches.
+func (c *PwnedClient) Lookup(ctx context.Context, password string) (Result, error) {
+	if ctx == nil {
+		ctx = context.Background()
 	}
 
-	box := c.doCheck(ctx, prefix)
-	defer box.Release()
+	if err := ctx.Err(); err != nil {
+		return Result{}, err
+	}
+
+	prefix, suffix, err := c.hash(password)
+	if err != nil {
+		return Result{}, err
+	}
+
+	return c.lookup(ctx, c.Mode, prefix, suffix, true)
+}
+
+// CheckHash is like Check, but checks an already computed hex SHA-1 hash of a
+// password (40 hex characters in any case) regardless of the client's Mode,
+// for callers that never hold the plaintext password. It returns
+// ErrorInvalidHash if the hash is malformed, without sending any requests. The
+// Cache is only consulted and recorded in if Mode is ModeSHA1.
+func (c *PwnedClient) CheckHash(ctx context.Context, sha1Hash string) (bool, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	prefix, suffix, err := ModeSHA1.splitHash(sha1Hash)
+	if err != nil {
+		return false, err
+	}
+
+	result, err := c.lookup(ctx, ModeSHA1, prefix, suffix, true)
+
+	return result.Pwned, err
+}
+
+// CheckNTLMHash is like Check, but checks an already computed hex NTLM hash of
+// a password (32 hex characters) regardless of the client's Mode, such as for
+// Active Directory integrations that never see plaintext passwords. It returns
+// ErrorInvalidHash if the hash is malformed. The Cache is only consulted and
+// recorded in if Mode is ModeNTLM, as it records ranges of the client's Mode.
+func (c *PwnedClient) CheckNTLMHash(ctx context.Context, ntlmHash string) (bool, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
 
-	res, err := box.Value()
+	prefix, suffix, err := ModeNTLM.splitHash(ntlmHash)
 	if err != nil {
 		return false, err
 	}
 
-	if res.StatusCode != http.StatusOK {
-		return false, &ErrorUnexpectedResponse{
-			Response: res,
+	result, err := c.lookup(ctx, ModeNTLM, prefix, suffix, true)
+
+	return result.Pwned, err
+}
+
+// CheckCount returns the number of times the password was found in a breach,
+// or 0 if it was not found. Like Check, concurrent calls sharing a prefix
+// result in a single request. The Cache is only consulted if it implements
+// CountingPwnedCache, but results are always recorded in it.
+func (c *PwnedClient) CheckCount(ctx context.Context, password string) (int, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	prefix, suffix, err := c.hash(password)
+	if err != nil {
+		return 0, err
+	}
+
+	_, counting := c.Cache.(CountingPwnedCache)
+
+	result, err := c.lookup(ctx, c.Mode, prefix, suffix, counting)
+
+	return result.Count, err
+}
+
+// cacheFor returns the Cache if it records ranges of the mode, or nil. As the
+// Cache is keyed by prefix alone, it only records ranges of the client's Mode,
+// and hashes of other modes are never looked up in it.
+func (c *PwnedClient) cacheFor(mode Mode) PwnedCache {
+	if mode != c.Mode {
+		return nil
+	}
+
+	return c.Cache
+}
+
+// cacheContains consults the Cache, reporting whether the suffix is contained
+// and whether the cache knows the complete set of suffixes of the prefix. The
+// OnCacheHit or OnCacheMiss hooks are called accordingly.
+func (c *PwnedClient) cacheContains(ctx context.Context, prefix, suffix []byte) (contains, known bool, err error) {
+	if knownCache, ok := c.Cache.(KnownPwnedCache); ok {
+		contains, known, err = knownCache.ContainsKnown(ctx, prefix, suffix)
+	} else {
+		contains, err = c.Cache.Contains(ctx, prefix, suffix)
+	}
+
+	if err != nil {
+		return contains, known, err
+	}
+
+	c.logCache(prefix, contains || known)
+
+	if contains || known {
+		c.stats.cacheHits.Add(1)
+
+		if c.OnCacheHit != nil {
+			c.OnCacheHit(string(prefix))
+		}
+	} else if c.OnCacheMiss != nil {
+		c.OnCacheMiss(string(prefix))
+	}
+
+	return contains, known, nil
+}
+
+// cacheCount is like cacheContains, but asks the cache for the occurrence count
+// of the suffix.
+func (c *PwnedClient) cacheCount(ctx context.Context, cache CountingPwnedCache, prefix, suffix []byte) (count int, ok bool, err error) {
+	count, ok, err = cache.Count(ctx, prefix, suffix)
+	if err != nil {
+		return count, ok, err
+	}
+
+	c.logCache(prefix, ok)
+
+	if ok {
+		c.stats.cacheHits.Add(1)
+
+		if c.OnCacheHit != nil {
+			c.OnCacheHit(string(prefix))
+		}
+	} else if c.OnCacheMiss != nil {
+		c.OnCacheMiss(string(prefix))
+	}
+
+	return count, ok, nil
+}
+
+// lookup looks up the suffix in the range of the prefix in the mode, first
+// consulting the Cache if useCache is set and it records ranges of the mode.
+func (c *PwnedClient) lookup(ctx context.Context, mode Mode, prefix, suffix []byte, useCache bool) (result Result, err error) {
+	result.Prefix = string(prefix)
+
+	defer func() {
+		c.countCheck(err)
+	}()
+
+	if c.StartSpan != nil {
+		var end func(SpanResult)
+
+		ctx, end = c.StartSpan(ctx, result.Prefix)
+
+		defer func() {
+			end(newSpanResult(result.FromCache, result.Pwned, err))
+		}()
+	}
+
+	if useCache && c.cacheFor(mode) != nil && !cacheBypassed(ctx) {
+		if c.isClosed() {
+			return Result{Prefix: result.Prefix}, ErrClosed
+		}
+
+		if countingCache, ok := c.Cache.(CountingPwnedCache); ok {
+			count, ok, err := c.cacheCount(ctx, countingCache, prefix, suffix)
+			if err != nil {
+				return Result{Prefix: result.Prefix}, err
+			}
+
+			if ok {
+				result.Count = count
+				result.Pwned = count > 0
+				result.FromCache = true
+
+				return result, c.audit(ctx, prefix, result.Pwned, count)
+			}
+		} else {
+			contains, known, err := c.cacheContains(ctx, prefix, suffix)
+			if err != nil {
+				return Result{Prefix: result.Prefix, Pwned: contains}, err
+			}
+
+			if contains || known {
+				result.Pwned = contains
+				result.FromCache = true
+
+				return result, c.audit(ctx, prefix, contains, 0)
+			}
 		}
 	}
 
-	buf := res.Body.(*pwnedResultBuffer)
+	err = c.withRange(ctx, mode, prefix, func(buf *pwnedResultBuffer) {
+		result.Count = buf.LookupCount(suffix)
+		result.ETag = buf.ETag
+	})
+	if err != nil {
+		return Result{Prefix: result.Prefix}, err
+	}
+
+	result.Pwned = result.Count > 0
 
-	return buf.Lookup(suffix), nil
+	return result, c.audit(ctx, prefix, result.Pwned, result.Count)
 }
 
-func (c *PwnedClient) doCheck(ctx context.Context, prefix []byte) *refcountBox[func() (*http.Response, error)] {
+// CheckCountString returns the number of times the password was found in a
+// breach as the raw decimal string from the Pwned Passwords API response, or
+// "0" if it was not found. Use it when the count must not be converted to a
+// fixed-size integer. The Cache is not consulted, as CountingPwnedCache only
+// answers with counts converted to int, but results are always recorded in it.
+func (c *PwnedClient) CheckCountString(ctx context.Context, password string) (string, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	if err := ctx.Err(); err != nil {
+		return "0", err
+	}
+
+	prefix, suffix, err := c.hash(password)
+	if err != nil {
+		return "0", err
+	}
+
+	count := "0"
+
+	err = c.withRange(ctx, c.Mode, prefix, func(buf *pwnedResultBuffer) {
+		if index := buf.Index(suffix); index >= 0 {
+			count = string(buf.Counts[index])
+		}
+	})
+	if err == nil {
+		err = c.audit(ctx, prefix, count != "0", parseCount([]byte(count)))
+	}
+
+	c.countCheck(err)
+
+	return count, err
+}
+
+// parseCount parses a decimal occurrence count, saturating at math.MaxInt.
+func parseCount(raw []byte) int {
+	count := 0
+
+	for _, digit := range raw {
+		if count > (math.MaxInt-9)/10 {
+			return math.MaxInt
+		}
+
+		count = count*10 + int(digit-'0')
+	}
+
+	return count
+}
+
+// withRange sends (or joins an in-flight) request for the prefix in the mode
+// and calls fn, if not nil, with the parsed result. The result is only valid
+// for the duration of fn.
+func (c *PwnedClient) withRange(ctx context.Context, mode Mode, prefix []byte, fn func(buf *pwnedResultBuffer)) error {
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+
+	box, err := c.doCheck(ctx, mode, prefix)
+	if err != nil {
+		return err
+	}
+
+	defer box.Release()
+
+	res, err := box.Value.Wait(ctx)
+	if err != nil {
+		return err
+	}
+
+	if res.StatusCode == http.StatusTooManyRequests {
+		return newErrorRateLimited(res)
+	}
+
+	// successful responses, including 304 Not Modified responses to
+	// revalidations, carry the parsed suffixes
+	buf, ok := res.Body.(*pwnedResultBuffer)
+	if !ok {
+		return newErrorUnexpectedResponse(res)
+	}
+
+	if c.OnServerDate != nil && !buf.Date.IsZero() {
+		c.OnServerDate(string(prefix), buf.Date)
+	}
+
+	if fn != nil {
+		fn(buf)
+	}
+
+	return nil
+}
+
+// upperHex is the alphabet for uppercase hex encoding.
+const upperHex = "0123456789ABCDEF"
+
+// appendUpperHex appends the uppercase hex encoding of src to dst.
+func appendUpperHex(dst, src []byte) []byte {
+	for _, b := range src {
+		dst = append(dst, upperHex[b>>4], upperHex[b&0x0f])
+	}
+
+	return dst
+}
+
+// HashPassword computes the uppercase hex SHA-1 of the password and splits it
+// into the 5 character prefix and 35 character suffix, exactly as Check does in
+// ModeSHA1, such as for custom caches or offline matchers keyed by them.
+func HashPassword(password string) (prefix, suffix string) {
+	prefixBytes, suffixBytes := hashPassword(password)
+
+	return string(prefixBytes), string(suffixBytes)
+}
+
+// hashPassword computes the uppercase hex SHA-1 of the password and splits it
+// into the 5 character prefix and 35 character suffix used by the Pwned
+// Passwords API. The hex encoding is written directly in uppercase into a
+// single buffer to avoid intermediate allocations.
+func hashPassword(password string) (prefix, suffix []byte) {
+	return hashPasswordBytes([]byte(password))
+}
+
+// hashPasswordBytes is like hashPassword, but for a password held in a byte
+// slice. No copies of the password are made.
+func hashPasswordBytes(password []byte) (prefix, suffix []byte) {
+	sum := sha1.Sum(password)
+	hexsum := appendUpperHex(make([]byte, 0, 2*sha1.Size), sum[:])
+
+	return hexsum[:prefixLength], hexsum[prefixLength:]
+}
+
+// hash computes the uppercase hex hash of the password in the client's Mode
+// and splits it into the prefix and suffix, using Hasher if set.
+func (c *PwnedClient) hash(password string) (prefix, suffix []byte, err error) {
+	if c.Hasher == nil {
+		prefix, suffix = c.Mode.hash(password)
+
+		return prefix, suffix, nil
+	}
+
+	return c.Mode.splitHash(c.Hasher(password))
+}
+
+// doCheck returns the in-flight request for the prefix, starting a new one if
+// there is none. The request is detached from the cancellation of ctx, instead
+// it is canceled once all callers have released the returned box.
+func (c *PwnedClient) doCheck(ctx context.Context, mode Mode, prefix []byte) (*refcountBox[*pwnedRequest], error) {
+	coalesced := false
+
+	defer func() {
+		// called after the lock has been released
+		if coalesced && c.OnCoalesced != nil {
+			c.OnCoalesced(string(prefix))
+		}
+	}()
+
 	c.lock.Lock()
 	defer c.lock.Unlock()
 
+	if c.closed {
+		return nil, ErrClosed
+	}
+
 	if c.requests == nil {
-		c.requests = make(map[string]*refcountBox[func() (*http.Response, error)])
+		c.requests = make(map[string]*refcountBox[*pwnedRequest])
 	}
 
-	prefixString := string(prefix)
+	// requests for the same prefix in different modes are distinct
+	key := string(prefix)
+	if mode != ModeSHA1 {
+		key = mode.String() + ":" + key
+	}
 
-	box, ok := c.requests[prefixString]
-	if !ok {
-		buffer := bufferPool.Get().(*bytes.Buffer)
-		suffixes := suffixesPool.Get().(*[][]byte)
-
-		box = &refcountBox[func() (*http.Response, error)]{
-			Value: sync.OnceValues(func() (*http.Response, error) {
-				return c.doRequest(ctx, &pwnedResultBuffer{
-					Buffer:   buffer,
-					Suffixes: *suffixes,
-				}, prefix)
-			}),
+	if c.DisableSingleFlight {
+		// a key no other check can find, so that the request is still
+		// tracked for Close
+		c.requestSeq += 1
+		key += "#" + strconv.FormatUint(c.requestSeq, 10)
+	}
+
+	box, coalesced := c.requests[key]
+	if coalesced && cacheBypassed(ctx) && box.Value.completed() {
+		// a result held for ReuseWindow is not fresh enough
+		coalesced = false
+	}
+
+	if coalesced && !box.TryAcquire() {
+		// the last caller released the box, but has not removed it
+		// from the map yet, so it must not be joined
+		coalesced = false
+	}
+
+	if coalesced {
+		c.stats.coalesced.Add(1)
+	} else {
+		buf := acquireResultBuffer()
+		buf.Mode = mode
+		buf.MaxEntries = c.maxEntries()
+		buf.SortSuffixes = true
+
+		if c.MaxConcurrency > 0 && c.sem == nil {
+			c.sem = make(chan struct{}, c.MaxConcurrency)
+		}
+
+		sem := c.sem
+
+		requestCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+
+		request := &pwnedRequest{
+			done:   make(chan struct{}),
+			cancel: cancel,
+		}
+
+		box = &refcountBox[*pwnedRequest]{
+			Value: request,
 			OnRelease: func() {
-				c.releaseRequest(prefixString)
+				c.releaseRequest(key, request)
 
-				bufferPool.Put(buffer)
-				suffixesPool.Put(suffixes)
+				request.cancel()
+
+				select {
+				case <-request.done:
+					releaseResultBuffer(buf)
+
+				default:
+					// the request is still running (but is
+					// now canceled), the buffers can only be
+					// reused once it has stopped
+					go func() {
+						<-request.done
+						releaseResultBuffer(buf)
+					}()
+				}
 			},
 		}
 
-		c.requests[prefixString] = box
+		// acquired before the request may hold on to its result
+		box.Acquire()
+
+		go func() {
+			defer close(request.done)
+
+			requestCtx := requestCtx
+
+			if c.Timeout > 0 {
+				// the caller's deadline is not inherited, as
+				// other callers may join the request later
+				var cancel context.CancelFunc
+
+				requestCtx, cancel = context.WithTimeout(requestCtx, c.Timeout)
+				defer cancel()
+			}
+
+			if c.CoalesceWindow > 0 {
+				if err := sleep(requestCtx, c.CoalesceWindow); err != nil {
+					request.err = err
+					return
+				}
+			}
+
+			if sem != nil {
+				select {
+				case sem <- struct{}{}:
+					defer func() { <-sem }()
+
+				case <-requestCtx.Done():
+					request.err = requestCtx.Err()
+					return
+				}
+			}
+
+			request.res, request.err = c.doRequestWithRetries(requestCtx, buf, prefix)
+
+			if c.ReuseWindow > 0 && !c.DisableSingleFlight && request.err == nil {
+				// hold on to parsed results, so that checks of
+				// the prefix arriving shortly after reuse them
+				if _, ok := request.res.Body.(*pwnedResultBuffer); ok && box.TryAcquire() {
+					time.AfterFunc(c.ReuseWindow, box.Release)
+				}
+			}
+		}()
+
+		c.requests[key] = box
+	}
+
+	return box, nil
+}
+
+// maxEntries returns the effective MaxEntries limit, where 0 means no limit.
+func (c *PwnedClient) maxEntries() int {
+	if c.MaxEntries == 0 {
+		return DefaultMaxEntries
 	}
 
-	box.Acquire()
+	if c.MaxEntries < 0 {
+		return 0
+	}
+
+	return c.MaxEntries
+}
+
+// isClosed reports whether Close has been called.
+func (c *PwnedClient) isClosed() bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.closed
+}
 
-	return box
+// maxResponseBytes returns the effective MaxResponseBytes limit, where 0 means
+// no limit.
+func (c *PwnedClient) maxResponseBytes() int64 {
+	if c.MaxResponseBytes == 0 {
+		return DefaultMaxResponseBytes
+	}
+
+	if c.MaxResponseBytes < 0 {
+		return 0
+	}
+
+	return c.MaxResponseBytes
+}
+
+// Close cancels all requests in flight, waiting for them to stop, and makes
+// all checks started afterwards fail with ErrClosed. Checks waiting on the
+// canceled requests fail with context.Canceled. Calling Close more than once
+// has no effect.
+func (c *PwnedClient) Close() error {
+	c.lock.Lock()
+
+	c.closed = true
+
+	requests := make([]*pwnedRequest, 0, len(c.requests))
+	for _, box := range c.requests {
+		requests = append(requests, box.Value)
+	}
+
+	c.lock.Unlock()
+
+	for _, request := range requests {
+		request.cancel()
+		<-request.done
+	}
+
+	return nil
 }
 
-func (c *PwnedClient) releaseRequest(prefix string) {
+// releaseRequest removes the released request from the in-flight requests.
+func (c *PwnedClient) releaseRequest(key string, request *pwnedRequest) {
 	c.lock.Lock()
 	defer c.lock.Unlock()
 
-	if c.requests != nil {
-		delete(c.requests, prefix)
+	// a new request for the key may have replaced the released one
+	if box, ok := c.requests[key]; ok && box.Value == request {
+		delete(c.requests, key)
 	}
 }
@@ -1,14 +1,23 @@
 package hibp
 
 import (
+	"bufio"
 	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/sha1"
+	"encoding/hex"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
+	"reflect"
+	"slices"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"testing"
+	"testing/iotest"
 	"time"
 )
 
@@ -59,6 +68,23 @@ func TestPwnedResultParsing(t *testing.T) {
 			},
 			Sorted: false,
 		},
+		{
+			Example: "0123456789ABCDEF0123456789ABCDEF012:1\r\n1123456789ABCDEF0123456789ABCDEF012:1\r\n",
+			Suffixes: [][]byte{
+				[]byte("0123456789ABCDEF0123456789ABCDEF012"),
+				[]byte("1123456789ABCDEF0123456789ABCDEF012"),
+			},
+			Sorted: true,
+		},
+		{
+			// bare CR line endings
+			Example: "0123456789ABCDEF0123456789ABCDEF012:1\r1123456789ABCDEF0123456789ABCDEF012:2\r",
+			Suffixes: [][]byte{
+				[]byte("0123456789ABCDEF0123456789ABCDEF012"),
+				[]byte("1123456789ABCDEF0123456789ABCDEF012"),
+			},
+			Sorted: true,
+		},
 		{
 			// padding line (0 ocurrences of the prefix)
 			Example:  "0123456789ABCDEF0123456789ABCDEF012:0\n",
@@ -72,9 +98,7 @@ func TestPwnedResultParsing(t *testing.T) {
 			Buffer: bytes.NewBuffer(nil),
 		}
 
-		buf.Buffer.WriteString(example.Example)
-
-		buf.Parse()
+		buf.ParseFrom(bytes.NewReader([]byte(example.Example)))
 
 		if buf.SuffixesSorted != example.Sorted {
 			t.Errorf("Unexpected sorting for example %d", i)
@@ -112,266 +136,2128 @@ func TestPwnedResultParsing(t *testing.T) {
 	}
 }
 
-type testHTTPClient struct {
-	Fn func(*http.Request) (*http.Response, error)
-}
-
-func (c *testHTTPClient) Do(r *http.Request) (*http.Response, error) {
-	return c.Fn(r)
-}
-
-func TestSingleRequestForSamePrefix(t *testing.T) {
-	called := int32(0)
-
-	pwnedClient := PwnedClient{
-		HTTP: &testHTTPClient{
-			Fn: func(r *http.Request) (*http.Response, error) {
-				atomic.AddInt32(&called, 1)
-
-				time.Sleep(10 * time.Millisecond)
+func TestPwnedResultParsingSortSuffixes(t *testing.T) {
+	buf := &pwnedResultBuffer{
+		SortSuffixes: true,
+		Buffer:       bytes.NewBuffer(nil),
+	}
 
-				return nil, context.Canceled
-			},
-		},
+	if err := buf.ParseFrom(bytes.NewReader([]byte("2123456789ABCDEF0123456789ABCDEF012:3\r\n0123456789ABCDEF0123456789ABCDEF012:1\r\n1123456789ABCDEF0123456789ABCDEF012:2\r\n"))); err != nil {
+		t.Fatalf("Unexpected error %v", err)
 	}
 
-	wg := &sync.WaitGroup{}
-	wg.Add(2)
+	if !buf.SuffixesSorted {
+		t.Errorf("Expected suffixes to be sorted")
+	}
 
-	for i := 0; i < 2; i += 1 {
-		go func() {
-			defer wg.Done()
+	for i, count := range []string{"1", "2", "3"} {
+		if string(buf.Suffixes[i][0]) != fmt.Sprint(i) || string(buf.Counts[i]) != count {
+			t.Errorf("Unexpected entry at position %d %q %q", i, buf.Suffixes[i], buf.Counts[i])
+		}
+	}
 
-			_, err := pwnedClient.Check(context.Background(), "password1")
-			if !errors.Is(err, context.Canceled) {
-				t.Errorf("Unexpected error %v", err)
-			}
-		}()
+	if buf.LookupCount([]byte("2123456789ABCDEF0123456789ABCDEF012")) != 3 {
+		t.Errorf("Expected to find suffix with its count after sorting")
 	}
+}
 
-	wg.Wait()
+func TestPwnedResultParsingMaxEntries(t *testing.T) {
+	buf := &pwnedResultBuffer{
+		MaxEntries: 2,
+		Buffer:     bytes.NewBuffer(nil),
+	}
 
-	if called != 1 {
-		t.Errorf("Expected a single HTTP call, but got %v", called)
+	if err := buf.ParseFrom(bytes.NewReader([]byte("0123456789ABCDEF0123456789ABCDEF012:1\n1123456789ABCDEF0123456789ABCDEF012:1\n"))); err != nil {
+		t.Errorf("Unexpected error %v", err)
 	}
-}
 
-type testErrorReader struct {
-	Error error
-}
+	buf.Suffixes = nil
+	buf.lines = 0
 
-func (r *testErrorReader) Read(into []byte) (int, error) {
-	return 0, r.Error
-}
+	err := buf.ParseFrom(bytes.NewReader([]byte("0123456789ABCDEF0123456789ABCDEF012:1\n1123456789ABCDEF0123456789ABCDEF012:1\n2123456789ABCDEF0123456789ABCDEF012:1\n")))
 
-func (r *testErrorReader) Close() error {
-	return nil
+	var tme *ErrorTooManyEntries
+	if !errors.As(err, &tme) {
+		t.Errorf("Expected ErrorTooManyEntries, got %v", err)
+	} else if tme.Limit != 2 {
+		t.Errorf("Unexpected limit %d", tme.Limit)
+	}
 }
 
-func TestFailingBodyRead(t *testing.T) {
+func TestCheckMaxEntries(t *testing.T) {
 	pwnedClient := PwnedClient{
+		MaxEntries: 1,
 		HTTP: &testHTTPClient{
 			Fn: func(r *http.Request) (*http.Response, error) {
 				return &http.Response{
 					StatusCode: http.StatusOK,
 					Status:     "200 OK",
 					Request:    r,
-					Body: &testErrorReader{
-						Error: context.Canceled,
-					},
+					Body:       io.NopCloser(bytes.NewReader([]byte("0123456789ABCDEF0123456789ABCDEF012:1\r\n214943DAAD1D64C102FAEC29DE4AFE9DA3D:1\r\n"))),
 				}, nil
 			},
 		},
 	}
 
+	_, err := pwnedClient.Check(context.Background(), "password1")
+
+	var tme *ErrorTooManyEntries
+	if !errors.As(err, &tme) {
+		t.Errorf("Expected ErrorTooManyEntries, got %v", err)
+	}
+
+	pwnedClient.MaxEntries = -1
+
 	res, err := pwnedClient.Check(context.Background(), "password1")
-	if !errors.Is(err, context.Canceled) {
+	if err != nil {
 		t.Errorf("Unexpected error %v", err)
 	}
 
-	if res {
-		t.Errorf("Expected result to be false but was true")
+	if !res {
+		t.Errorf("Expected result to be true, but was false")
 	}
 }
 
-func TestNilContextToDoRequest(t *testing.T) {
-	pwnedClient := PwnedClient{
-		HTTP: &testHTTPClient{
-			Fn: func(r *http.Request) (*http.Response, error) {
-				return nil, context.Canceled
-			},
-		},
+func TestHashPassword(t *testing.T) {
+	for _, password := range []string{"", "password1", "correct horse battery staple", "\x00\xff"} {
+		sum := sha1.Sum([]byte(password))
+		expected := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+		prefix, suffix := hashPassword(password)
+
+		if string(prefix) != expected[:5] || string(suffix) != expected[5:] {
+			t.Errorf("Unexpected hash for %q %s%s expected %s", password, prefix, suffix, expected)
+		}
 	}
+}
 
-	//lint:ignore SA1012 intentionally passing a nil Context below to
-	// trigger the error return from http.NewRequestWithContext internally
-	_, err := pwnedClient.doRequest(nil, &pwnedResultBuffer{}, []byte("ABCDE"))
-	if err.Error() != "net/http: nil Context" {
+func TestHashPasswordExported(t *testing.T) {
+	examples := []struct {
+		Password string
+		Prefix   string
+		Suffix   string
+	}{
+		{"password1", "E38AD", "214943DAAD1D64C102FAEC29DE4AFE9DA3D"},
+		{"password", "5BAA6", "1E4C9B93F3F0682250B6CF8331B7EE68FD8"},
+		{"", "DA39A", "3EE5E6B4B0D3255BFEF95601890AFD80709"},
+	}
+
+	for _, example := range examples {
+		prefix, suffix := HashPassword(example.Password)
+
+		if prefix != example.Prefix || suffix != example.Suffix {
+			t.Errorf("Unexpected hash for %q %s %s", example.Password, prefix, suffix)
+		}
+	}
+}
+
+func TestPwnedResultParseFrom(t *testing.T) {
+	examples := []string{
+		"",
+		"invalid example\n",
+		"0123456789ABCDEF0123456789ABCDEF012:1\r\n1123456789ABCDEF0123456789ABCDEF012:2\r\n",
+		"0123456789ABCDEF0123456789ABCDEF012:1\r1123456789ABCDEF0123456789ABCDEF012:2\n\n2123456789ABCDEF0123456789ABCDEF012:0\r\n",
+		"2123456789ABCDEF0123456789ABCDEF012:3\n0123456789ABCDEF0123456789ABCDEF012:1",
+	}
+
+	for i, example := range examples {
+		expected := &pwnedResultBuffer{
+			Buffer: bytes.NewBuffer(nil),
+		}
+
+		if err := expected.ParseFrom(bytes.NewReader([]byte(example))); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+
+		// reading a byte at a time splits CRLF line endings
+		buf := &pwnedResultBuffer{
+			Buffer: bytes.NewBuffer(nil),
+		}
+
+		if err := buf.ParseFrom(iotest.OneByteReader(strings.NewReader(example))); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+
+		if !reflect.DeepEqual(buf.Suffixes, expected.Suffixes) || !reflect.DeepEqual(buf.Counts, expected.Counts) || buf.SuffixesSorted != expected.SuffixesSorted || buf.Entries != expected.Entries {
+			t.Errorf("Example %d: result %q %q read a byte at a time differs from %q %q", i, buf.Suffixes, buf.Counts, expected.Suffixes, expected.Counts)
+		}
+	}
+
+	buf := &pwnedResultBuffer{
+		Buffer: bytes.NewBuffer(nil),
+	}
+
+	if err := buf.ParseFrom(strings.NewReader(strings.Repeat("x", maxLineLength+1))); !errors.Is(err, bufio.ErrTooLong) {
 		t.Errorf("Unexpected error %v", err)
 	}
 }
 
-type testPwnedCache struct {
-	AddFn      func(context.Context, []byte, [][]byte) error
-	ContainsFn func(context.Context, []byte, []byte) (bool, error)
+// benchmarkResponse is a response of the usual size with padding.
+var benchmarkResponse = func() []byte {
+	response := &bytes.Buffer{}
+
+	for i := 0; i < 2000; i += 1 {
+		fmt.Fprintf(response, "%035X:%d\r\n", i*0x1234567, i%3)
+	}
+
+	return response.Bytes()
+}()
+
+func BenchmarkParseFrom(b *testing.B) {
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i += 1 {
+		buf := &pwnedResultBuffer{
+			Buffer: bytes.NewBuffer(make([]byte, 0, 4*1024)),
+		}
+
+		buf.ParseFrom(bytes.NewReader(benchmarkResponse))
+	}
 }
 
-func (c *testPwnedCache) Add(ctx context.Context, prefix []byte, suffixes [][]byte) error {
-	return c.AddFn(ctx, prefix, suffixes)
+func TestPwnedResultLineEndings(t *testing.T) {
+	const (
+		a = "0123456789ABCDEF0123456789ABCDEF012"
+		b = "1123456789ABCDEF0123456789ABCDEF012"
+		c = "2123456789ABCDEF0123456789ABCDEF012"
+	)
+
+	examples := []struct {
+		Name string
+		Body string
+	}{
+		{"LF", a + ":1\n" + b + ":2\n" + c + ":3\n"},
+		{"CRLF", a + ":1\r\n" + b + ":2\r\n" + c + ":3\r\n"},
+		{"CR", a + ":1\r" + b + ":2\r" + c + ":3\r"},
+		{"no trailing newline", a + ":1\r\n" + b + ":2\r\n" + c + ":3"},
+		{"mixed", a + ":1\n" + b + ":2\r\n" + c + ":3\r"},
+		{"mixed with blank lines", a + ":1\r\n\r\n" + b + ":2\n\r" + c + ":3"},
+		{"doubled CR", a + ":1\r\r\n" + b + ":2\r\r\n" + c + ":3\r\r\n"},
+		{"whitespace", " " + a + ":1 \r\n\t" + b + ":2\t\n" + c + ":3  "},
+	}
+
+	for _, example := range examples {
+		buf := &pwnedResultBuffer{
+			Buffer: bytes.NewBuffer(nil),
+		}
+
+		// reading a byte at a time splits the line endings
+		if err := buf.ParseFrom(iotest.OneByteReader(strings.NewReader(example.Body))); err != nil {
+			t.Fatalf("Unexpected error for %s %v", example.Name, err)
+		}
+
+		if buf.Entries != 3 || !buf.FullyFetched {
+			t.Errorf("Unexpected entries for %s %d %v", example.Name, buf.Entries, buf.FullyFetched)
+		}
+
+		for i, suffix := range []string{a, b, c} {
+			if count := buf.LookupCount([]byte(suffix)); count != i+1 {
+				t.Errorf("Unexpected count for %s %s %d", example.Name, suffix, count)
+			}
+		}
+	}
 }
 
-func (c *testPwnedCache) Contains(ctx context.Context, prefix []byte, suffix []byte) (bool, error) {
-	return c.ContainsFn(ctx, prefix, suffix)
+func TestPwnedResultFullyFetched(t *testing.T) {
+	examples := []struct {
+		Body         string
+		FullyFetched bool
+	}{
+		{"", true},
+		{"0123456789ABCDEF0123456789ABCDEF012:0\r\n1123456789ABCDEF0123456789ABCDEF012:0\r\n", true},
+		{"0123456789ABCDEF0123456789ABCDEF012:1\r\n", true},
+		{"<html>Bad Gateway</html>\n", false},
+		{"0123456789ABCDEF0123456789ABCDEF012:1\r\ninvalid\r\n", false},
+	}
+
+	for _, example := range examples {
+		buf := &pwnedResultBuffer{
+			Buffer: bytes.NewBuffer(nil),
+		}
+
+		if err := buf.ParseFrom(strings.NewReader(example.Body)); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+
+		if buf.FullyFetched != example.FullyFetched {
+			t.Errorf("Unexpected FullyFetched %v for %q", buf.FullyFetched, example.Body)
+		}
+	}
 }
 
-func TestCheckWithNilContext(t *testing.T) {
+func TestEmptyRangeCachedOnlyIfFullyFetched(t *testing.T) {
+	for _, example := range []struct {
+		Body  string
+		Calls int
+	}{
+		{"0123456789ABCDEF0123456789ABCDEF012:0\r\n", 1},
+		{"0123456789ABCDEF0123456789ABCDEF012:0\r\nunparseable\n", 2},
+	} {
+		calls := 0
+
+		pwnedClient := PwnedClient{
+			Cache: NewLRUCache(10),
+			HTTP: &testHTTPClient{
+				Fn: func(r *http.Request) (*http.Response, error) {
+					calls += 1
+
+					return &http.Response{
+						StatusCode: http.StatusOK,
+						Body:       io.NopCloser(strings.NewReader(example.Body)),
+						Request:    r,
+					}, nil
+				},
+			},
+		}
+
+		for i := 0; i < 2; i += 1 {
+			if _, err := pwnedClient.Check(context.Background(), "password1"); err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+		}
+
+		if calls != example.Calls {
+			t.Errorf("Expected %d calls for %q, got %d", example.Calls, example.Body, calls)
+		}
+	}
+}
+
+func TestTruncatedRangeNotCached(t *testing.T) {
+	calls := 0
+
+	cache := NewLRUCache(10)
+
 	pwnedClient := PwnedClient{
+		Cache: cache,
 		HTTP: &testHTTPClient{
 			Fn: func(r *http.Request) (*http.Response, error) {
+				calls += 1
+
+				// cut off in the middle of the line of password1
 				return &http.Response{
 					StatusCode: http.StatusOK,
-					Status:     "200 OK",
+					Body:       io.NopCloser(strings.NewReader("0123456789ABCDEF0123456789ABCDEF012:3\r\n214943DAAD1D64C10")),
 					Request:    r,
-					Body:       io.NopCloser(bytes.NewReader([]byte("214943DAAD1D64C102FAEC29DE4AFE9DA3D:1\r\n"))),
 				}, nil
 			},
 		},
 	}
 
-	//lint:ignore SA1012 intentionally passing nil Context to check that
-	// the function will use context.Background() properly
-	_, err := pwnedClient.Check(nil, "password1")
-	if err != nil {
-		t.Errorf("Unexpected error %v", err)
-		return
+	for i := 0; i < 2; i += 1 {
+		if _, err := pwnedClient.Check(context.Background(), "password1"); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
 	}
-}
 
-func TestPwnedCache(t *testing.T) {
-	addCalls := 0
-	containsCalls := 0
-	httpCalls := 0
+	if calls != 2 {
+		t.Errorf("Expected the truncated range not to answer from the cache, got %d calls", calls)
+	}
 
-	var prefix []byte
-	var suffixes [][]byte
+	if cache.Len() != 0 {
+		t.Errorf("Expected the truncated range not to be cached")
+	}
+}
 
+func TestLowercaseSuffixes(t *testing.T) {
 	pwnedClient := PwnedClient{
-		Cache: &testPwnedCache{
-			AddFn: func(ctx context.Context, addPrefix []byte, addSuffixes [][]byte) error {
-				addCalls += 1
-
-				prefix = make([]byte, len(addPrefix))
-				copy(prefix, addPrefix)
-
-				suffixes = make([][]byte, len(addSuffixes))
-				for i := range addSuffixes {
-					suffixes[i] = make([]byte, len(addSuffixes[i]))
-					copy(suffixes[i], addSuffixes[i])
-				}
-
-				return nil
-			},
-			ContainsFn: func(ctx context.Context, containsPrefix, containsSuffix []byte) (bool, error) {
-				containsCalls += 1
-
-				if !bytes.Equal(containsPrefix, prefix) {
-					return false, nil
-				}
-
-				for _, suffix := range suffixes {
-					if bytes.Equal(containsSuffix, suffix) {
-						return true, nil
-					}
-				}
-
-				return false, nil
-			},
-		},
 		HTTP: &testHTTPClient{
 			Fn: func(r *http.Request) (*http.Response, error) {
-				httpCalls += 1
-
 				return &http.Response{
 					StatusCode: http.StatusOK,
 					Status:     "200 OK",
 					Request:    r,
-					Body:       io.NopCloser(bytes.NewReader([]byte("214943DAAD1D64C102FAEC29DE4AFE9DA3D:1\r\n"))),
+					Body:       io.NopCloser(strings.NewReader("0123456789abcdef0123456789abcdef012:3\r\n214943daad1d64c102faec29de4afe9da3d:42\r\n")),
 				}, nil
 			},
 		},
 	}
 
-	res, err := pwnedClient.Check(context.Background(), "password1")
-	if err != nil {
-		t.Errorf("Unexpected error %v", err)
-		return
+	count, err := pwnedClient.CheckCount(context.Background(), "password1")
+	if err != nil || count != 42 {
+		t.Errorf("Unexpected result %d %v", count, err)
 	}
 
-	if !res {
-		t.Error("Expected to find the password, but didn't")
+	counts, err := pwnedClient.Range(context.Background(), "E38AD")
+	if err != nil || counts["0123456789ABCDEF0123456789ABCDEF012"] != 3 {
+		t.Errorf("Expected suffixes to be normalized to uppercase, got %v %v", counts, err)
 	}
+}
 
-	if addCalls != 1 {
-		t.Errorf("Add was called %d times, but was supposed to be called once", addCalls)
+func TestPwnedResultLookupAllocs(t *testing.T) {
+	buf := &pwnedResultBuffer{
+		Buffer: bytes.NewBuffer(make([]byte, 0, 4*1024)),
 	}
 
-	if containsCalls != 1 {
-		t.Errorf("Contains was called %d times, but was supposed to be called once", containsCalls)
+	if err := buf.ParseFrom(bytes.NewReader(benchmarkResponse)); err != nil {
+		t.Fatalf("Unexpected error %v", err)
 	}
 
-	if httpCalls != 1 {
-		t.Errorf("HTTP API was called %d times, but was supposed to be called once", httpCalls)
-	}
+	suffix := bytes.Clone(buf.Suffixes[len(buf.Suffixes)/2])
 
-	res, err = pwnedClient.Check(context.Background(), "password1")
-	if err != nil {
-		t.Errorf("Unexpected error %v", err)
-		return
-	}
+	allocs := testing.AllocsPerRun(100, func() {
+		if !buf.Lookup(suffix) {
+			t.Errorf("Expected to find suffix")
+		}
+	})
+
+	if allocs != 0 {
+		t.Errorf("Expected Lookup not to allocate, got %v allocations", allocs)
+	}
+}
+
+func BenchmarkLookup(b *testing.B) {
+	buf := &pwnedResultBuffer{
+		Buffer: bytes.NewBuffer(make([]byte, 0, 4*1024)),
+	}
+
+	buf.ParseFrom(bytes.NewReader(benchmarkResponse))
+
+	suffix := bytes.Clone(buf.Suffixes[len(buf.Suffixes)/2])
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i += 1 {
+		buf.Lookup(suffix)
+	}
+}
+
+func BenchmarkHashPassword(b *testing.B) {
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i += 1 {
+		hashPassword("password1")
+	}
+}
+
+func BenchmarkHashPasswordToUpper(b *testing.B) {
+	b.ReportAllocs()
+
+	// previous implementation, for comparison
+	for i := 0; i < b.N; i += 1 {
+		sum := sha1.Sum([]byte("password1"))
+		hexsum := []byte(strings.ToUpper(hex.EncodeToString(sum[:])))
+		_, _ = hexsum[:5], hexsum[5:]
+	}
+}
+
+func TestCheckMinEntries(t *testing.T) {
+	pwnedClient := PwnedClient{
+		MinEntries: 3,
+		HTTP: &testHTTPClient{
+			Fn: func(r *http.Request) (*http.Response, error) {
+				return &http.Response{
+					StatusCode: http.StatusOK,
+					Status:     "200 OK",
+					Request:    r,
+					Body:       io.NopCloser(bytes.NewReader([]byte("0123456789ABCDEF0123456789ABCDEF012:0\r\ninvalid\r\n214943DAAD1D64C102FAEC29DE4AFE9DA3D:1\r\n"))),
+				}, nil
+			},
+		},
+	}
+
+	_, err := pwnedClient.Check(context.Background(), "password1")
+
+	var tfe *ErrorTooFewEntries
+	if !errors.As(err, &tfe) {
+		t.Errorf("Expected ErrorTooFewEntries, got %v", err)
+	} else if tfe.Entries != 2 || tfe.Minimum != 3 {
+		t.Errorf("Unexpected error %v", tfe)
+	}
+
+	pwnedClient.MinEntries = 2
+
+	res, err := pwnedClient.Check(context.Background(), "password1")
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	if !res {
+		t.Errorf("Expected result to be true, but was false")
+	}
+}
+
+type testHTTPClient struct {
+	Fn func(*http.Request) (*http.Response, error)
+}
+
+func (c *testHTTPClient) Do(r *http.Request) (*http.Response, error) {
+	return c.Fn(r)
+}
+
+func TestSingleRequestForSamePrefix(t *testing.T) {
+	called := int32(0)
+
+	pwnedClient := PwnedClient{
+		HTTP: &testHTTPClient{
+			Fn: func(r *http.Request) (*http.Response, error) {
+				atomic.AddInt32(&called, 1)
+
+				time.Sleep(10 * time.Millisecond)
+
+				return nil, context.Canceled
+			},
+		},
+	}
+
+	wg := &sync.WaitGroup{}
+	wg.Add(2)
+
+	for i := 0; i < 2; i += 1 {
+		go func() {
+			defer wg.Done()
+
+			_, err := pwnedClient.Check(context.Background(), "password1")
+			if !errors.Is(err, context.Canceled) {
+				t.Errorf("Unexpected error %v", err)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if called != 1 {
+		t.Errorf("Expected a single HTTP call, but got %v", called)
+	}
+}
+
+func TestDisableSingleFlight(t *testing.T) {
+	called := int32(0)
+	coalesced := int32(0)
+
+	release := make(chan struct{})
+
+	pwnedClient := PwnedClient{
+		DisableSingleFlight: true,
+		OnCoalesced: func(prefix string) {
+			atomic.AddInt32(&coalesced, 1)
+		},
+		HTTP: &testHTTPClient{
+			Fn: func(r *http.Request) (*http.Response, error) {
+				atomic.AddInt32(&called, 1)
+
+				<-release
+
+				return nil, context.Canceled
+			},
+		},
+	}
+
+	wg := &sync.WaitGroup{}
+	wg.Add(4)
+
+	for i := 0; i < 4; i += 1 {
+		go func() {
+			defer wg.Done()
+
+			_, err := pwnedClient.Check(context.Background(), "password1")
+			if !errors.Is(err, context.Canceled) {
+				t.Errorf("Unexpected error %v", err)
+			}
+		}()
+	}
+
+	// all requests are in flight at once before any is let through
+	for atomic.LoadInt32(&called) < 4 {
+		time.Sleep(time.Millisecond)
+	}
+
+	close(release)
+	wg.Wait()
+
+	if called != 4 {
+		t.Errorf("Expected 4 HTTP calls, but got %v", called)
+	}
+
+	if coalesced != 0 {
+		t.Errorf("Expected no coalesced checks, but got %v", coalesced)
+	}
+
+	if len(pwnedClient.requests) != 0 {
+		t.Errorf("Expected no tracked requests, but got %v", len(pwnedClient.requests))
+	}
+}
+
+func TestReuseWindow(t *testing.T) {
+	called := int32(0)
+
+	pwnedClient := PwnedClient{
+		ReuseWindow: 20 * time.Millisecond,
+		HTTP: &testHTTPClient{
+			Fn: func(r *http.Request) (*http.Response, error) {
+				atomic.AddInt32(&called, 1)
+
+				return &http.Response{
+					StatusCode: http.StatusOK,
+					Body:       io.NopCloser(strings.NewReader("214943DAAD1D64C102FAEC29DE4AFE9DA3D:1\r\n")),
+					Request:    r,
+				}, nil
+			},
+		},
+	}
+
+	ctx := context.Background()
+
+	for i := 0; i < 2; i += 1 {
+		pwned, err := pwnedClient.Check(ctx, "password1")
+		if err != nil || !pwned {
+			t.Fatalf("Unexpected result %v %v", pwned, err)
+		}
+	}
+
+	if called != 1 {
+		t.Errorf("Expected a single HTTP call, but got %v", called)
+	}
+
+	if _, err := pwnedClient.Check(ContextWithCacheBypass(ctx), "password1"); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if called != 2 {
+		t.Errorf("Expected bypassing check to send a request, but got %v calls", called)
+	}
+
+	// the result is released after the window
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(time.Millisecond) {
+		pwnedClient.lock.Lock()
+		requests := len(pwnedClient.requests)
+		pwnedClient.lock.Unlock()
+
+		if requests == 0 {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected result to be released, but %v requests are held", requests)
+		}
+	}
+
+	if _, err := pwnedClient.Check(ctx, "password1"); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if called != 3 {
+		t.Errorf("Expected a new request after the window, but got %v calls", called)
+	}
+}
+
+func TestSingleFlightChurn(t *testing.T) {
+	pwnedClient := PwnedClient{
+		HTTP: &testHTTPClient{
+			Fn: func(r *http.Request) (*http.Response, error) {
+				return &http.Response{
+					StatusCode: http.StatusOK,
+					Body:       io.NopCloser(strings.NewReader("214943DAAD1D64C102FAEC29DE4AFE9DA3D:1\r\n")),
+					Request:    r,
+				}, nil
+			},
+		},
+	}
+
+	wg := &sync.WaitGroup{}
+
+	// checks of the same prefix keep joining and releasing requests, some
+	// leaving early, so boxes are constantly released while being looked
+	// up
+	for i := 0; i < 32; i += 1 {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			for j := 0; j < 200; j += 1 {
+				ctx, cancel := context.WithCancel(context.Background())
+				if (i+j)%3 == 0 {
+					go cancel()
+				}
+
+				pwned, err := pwnedClient.Check(ctx, "password1")
+				cancel()
+
+				if err != nil && !errors.Is(err, context.Canceled) {
+					t.Errorf("Unexpected error %v", err)
+				}
+
+				if err == nil && !pwned {
+					t.Errorf("Expected result to be true, but was false")
+				}
+			}
+		}(i)
+	}
+
+	wg.Wait()
+
+	pwnedClient.lock.Lock()
+	defer pwnedClient.lock.Unlock()
+
+	if len(pwnedClient.requests) != 0 {
+		t.Errorf("Expected no requests in flight, got %d", len(pwnedClient.requests))
+	}
+}
+
+func TestOnCoalesced(t *testing.T) {
+	const checks = 10
+
+	coalesced := make(chan string, checks)
+	release := make(chan struct{})
+	called := int32(0)
+
+	pwnedClient := PwnedClient{
+		OnCoalesced: func(prefix string) {
+			coalesced <- prefix
+		},
+		HTTP: &testHTTPClient{
+			Fn: func(r *http.Request) (*http.Response, error) {
+				atomic.AddInt32(&called, 1)
+
+				<-release
+
+				return nil, context.Canceled
+			},
+		},
+	}
+
+	wg := &sync.WaitGroup{}
+
+	for i := 0; i < checks; i += 1 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			pwnedClient.Check(context.Background(), "password1")
+		}()
+	}
+
+	// all but the first check join its request
+	for i := 0; i < checks-1; i += 1 {
+		if prefix := <-coalesced; prefix != "E38AD" {
+			t.Errorf("Unexpected prefix %q", prefix)
+		}
+	}
+
+	close(release)
+	wg.Wait()
+
+	if len(coalesced) != 0 || called != 1 {
+		t.Errorf("Expected %d coalesced checks and 1 request, got %d more and %d", checks-1, len(coalesced), called)
+	}
+}
+
+func TestClose(t *testing.T) {
+	started := make(chan struct{})
+	stopped := int32(0)
+
+	pwnedClient := PwnedClient{
+		Cache: NewLRUCache(10),
+		HTTP: &testHTTPClient{
+			Fn: func(r *http.Request) (*http.Response, error) {
+				close(started)
+
+				<-r.Context().Done()
+				atomic.StoreInt32(&stopped, 1)
+
+				return nil, r.Context().Err()
+			},
+		},
+	}
+
+	errs := make(chan error)
+
+	go func() {
+		_, err := pwnedClient.Check(context.Background(), "password1")
+		errs <- err
+	}()
+
+	<-started
+
+	if err := pwnedClient.Close(); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	if atomic.LoadInt32(&stopped) != 1 {
+		t.Errorf("Expected Close to wait for requests in flight to stop")
+	}
+
+	if err := <-errs; !errors.Is(err, context.Canceled) {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	for i := 0; i < 2; i += 1 {
+		if _, err := pwnedClient.Check(context.Background(), "password2"); !errors.Is(err, ErrClosed) {
+			t.Errorf("Unexpected error %v", err)
+		}
+
+		if _, err := pwnedClient.CheckCount(context.Background(), "password2"); !errors.Is(err, ErrClosed) {
+			t.Errorf("Unexpected error %v", err)
+		}
+
+		if err := pwnedClient.Close(); err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+	}
+}
+
+func TestMaxConcurrency(t *testing.T) {
+	inFlight := int32(0)
+	peak := int32(0)
+	called := int32(0)
+
+	pwnedClient := PwnedClient{
+		MaxConcurrency: 3,
+		HTTP: &testHTTPClient{
+			Fn: func(r *http.Request) (*http.Response, error) {
+				atomic.AddInt32(&called, 1)
+
+				current := atomic.AddInt32(&inFlight, 1)
+				defer atomic.AddInt32(&inFlight, -1)
+
+				for {
+					previous := atomic.LoadInt32(&peak)
+					if current <= previous || atomic.CompareAndSwapInt32(&peak, previous, current) {
+						break
+					}
+				}
+
+				time.Sleep(5 * time.Millisecond)
+
+				return nil, context.Canceled
+			},
+		},
+	}
+
+	wg := &sync.WaitGroup{}
+
+	for i := 0; i < 20; i += 1 {
+		for j := 0; j < 2; j += 1 {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+
+				_, err := pwnedClient.CheckHash(context.Background(), fmt.Sprintf("%05X%035d", i, 0))
+				if !errors.Is(err, context.Canceled) {
+					t.Errorf("Unexpected error %v", err)
+				}
+			}(i)
+		}
+	}
+
+	wg.Wait()
+
+	if peak > 3 {
+		t.Errorf("Expected at most 3 concurrent requests, got %d", peak)
+	}
+
+	if called < 20 {
+		t.Errorf("Expected a request for each of the 20 prefixes, got %d", called)
+	}
+}
+
+func TestMaxConcurrencyCanceledWhileWaiting(t *testing.T) {
+	unblock := make(chan struct{})
+
+	pwnedClient := PwnedClient{
+		MaxConcurrency: 1,
+		HTTP: &testHTTPClient{
+			Fn: func(r *http.Request) (*http.Response, error) {
+				<-unblock
+
+				return nil, context.Canceled
+			},
+		},
+	}
+
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		pwnedClient.Check(context.Background(), "password1")
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err := pwnedClient.Check(ctx, "password2")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	close(unblock)
+	<-done
+}
+
+func TestCancelSharedRequestWhenAllCallersLeave(t *testing.T) {
+	canceled := make(chan struct{})
+
+	pwnedClient := PwnedClient{
+		HTTP: &testHTTPClient{
+			Fn: func(r *http.Request) (*http.Response, error) {
+				<-r.Context().Done()
+				close(canceled)
+
+				return nil, r.Context().Err()
+			},
+		},
+	}
+
+	wg := &sync.WaitGroup{}
+	wg.Add(2)
+
+	for i := 0; i < 2; i += 1 {
+		go func() {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			defer cancel()
+
+			_, err := pwnedClient.Check(ctx, "password1")
+			if !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("Unexpected error %v", err)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	select {
+	case <-canceled:
+	case <-time.After(time.Second):
+		t.Errorf("Shared request was not canceled after all callers left")
+	}
+}
+
+func TestSharedRequestSurvivesFirstCallerLeaving(t *testing.T) {
+	proceed := make(chan struct{})
+
+	pwnedClient := PwnedClient{
+		HTTP: &testHTTPClient{
+			Fn: func(r *http.Request) (*http.Response, error) {
+				<-proceed
+
+				return &http.Response{
+					StatusCode: http.StatusOK,
+					Status:     "200 OK",
+					Request:    r,
+					Body:       io.NopCloser(bytes.NewReader([]byte("214943DAAD1D64C102FAEC29DE4AFE9DA3D:1\r\n"))),
+				}, r.Context().Err()
+			},
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	firstDone := make(chan struct{})
+	go func() {
+		defer close(firstDone)
+
+		_, err := pwnedClient.Check(ctx, "password1")
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Unexpected error %v", err)
+		}
+	}()
+
+	secondDone := make(chan struct{})
+	go func() {
+		defer close(secondDone)
+
+		// wait for the first caller to start the shared request
+		for {
+			pwnedClient.lock.Lock()
+			started := len(pwnedClient.requests) > 0
+			pwnedClient.lock.Unlock()
+
+			if started {
+				break
+			}
+
+			time.Sleep(time.Millisecond)
+		}
+
+		res, err := pwnedClient.Check(context.Background(), "password1")
+		if err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+
+		if !res {
+			t.Errorf("Expected result to be true, but was false")
+		}
+	}()
+
+	for {
+		pwnedClient.lock.Lock()
+		waiters := int32(0)
+		for _, box := range pwnedClient.requests {
+			waiters = atomic.LoadInt32(&box.Refcount)
+		}
+		pwnedClient.lock.Unlock()
+
+		if waiters == 2 {
+			break
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+
+	cancel()
+	<-firstDone
+
+	close(proceed)
+	<-secondDone
+}
+
+func TestCoalesceWindow(t *testing.T) {
+	clock := useFakeClock(t)
+
+	waiting := make(chan struct{})
+	release := make(chan struct{})
+
+	// the window only passes once the second check has joined
+	sleep = func(ctx context.Context, d time.Duration) error {
+		close(waiting)
+		<-release
+
+		return clock.Sleep(ctx, d)
+	}
+
+	called := int32(0)
+
+	pwnedClient := PwnedClient{
+		CoalesceWindow: 50 * time.Millisecond,
+		OnCoalesced: func(prefix string) {
+			close(release)
+		},
+		HTTP: &testHTTPClient{
+			Fn: func(r *http.Request) (*http.Response, error) {
+				atomic.AddInt32(&called, 1)
+
+				return nil, context.Canceled
+			},
+		},
+	}
+
+	wg := &sync.WaitGroup{}
+	wg.Add(2)
+
+	check := func() {
+		defer wg.Done()
+
+		_, err := pwnedClient.Check(context.Background(), "password1")
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Unexpected error %v", err)
+		}
+	}
+
+	go check()
+
+	// second check arrives while the first one waits for the window
+	<-waiting
+
+	go check()
+
+	wg.Wait()
+
+	if called != 1 {
+		t.Errorf("Expected a single HTTP call, but got %v", called)
+	}
+
+	if sleeps := clock.Sleeps(); !reflect.DeepEqual(sleeps, []time.Duration{50 * time.Millisecond}) {
+		t.Errorf("Unexpected window %v", sleeps)
+	}
+}
+
+func BenchmarkCoalesceWindow(b *testing.B) {
+	for _, window := range []time.Duration{0, 2 * time.Millisecond} {
+		b.Run(window.String(), func(b *testing.B) {
+			called := int32(0)
+
+			pwnedClient := PwnedClient{
+				CoalesceWindow: window,
+				HTTP: &testHTTPClient{
+					Fn: func(r *http.Request) (*http.Response, error) {
+						atomic.AddInt32(&called, 1)
+
+						return &http.Response{
+							StatusCode: http.StatusOK,
+							Status:     "200 OK",
+							Request:    r,
+							Body:       io.NopCloser(bytes.NewReader([]byte("214943DAAD1D64C102FAEC29DE4AFE9DA3D:1\r\n"))),
+						}, nil
+					},
+				},
+			}
+
+			for i := 0; i < b.N; i += 1 {
+				wg := &sync.WaitGroup{}
+
+				// a burst of checks for the same prefix arriving
+				// microseconds apart
+				for j := 0; j < 16; j += 1 {
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+
+						pwnedClient.Check(context.Background(), "password1")
+					}()
+
+					// spin instead of sleeping, as timer
+					// resolution is too coarse for this
+					for start := time.Now(); time.Since(start) < 50*time.Microsecond; {
+					}
+				}
+
+				wg.Wait()
+			}
+
+			b.ReportMetric(float64(called)/float64(b.N), "requests/op")
+		})
+	}
+}
+
+type testErrorReader struct {
+	Error error
+}
+
+func (r *testErrorReader) Read(into []byte) (int, error) {
+	return 0, r.Error
+}
+
+func (r *testErrorReader) Close() error {
+	return nil
+}
+
+func TestFailingBodyRead(t *testing.T) {
+	pwnedClient := PwnedClient{
+		HTTP: &testHTTPClient{
+			Fn: func(r *http.Request) (*http.Response, error) {
+				return &http.Response{
+					StatusCode: http.StatusOK,
+					Status:     "200 OK",
+					Request:    r,
+					Body: &testErrorReader{
+						Error: context.Canceled,
+					},
+				}, nil
+			},
+		},
+	}
+
+	res, err := pwnedClient.Check(context.Background(), "password1")
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	if res {
+		t.Errorf("Expected result to be false but was true")
+	}
+}
+
+func TestNilContextToDoRequest(t *testing.T) {
+	pwnedClient := PwnedClient{
+		HTTP: &testHTTPClient{
+			Fn: func(r *http.Request) (*http.Response, error) {
+				return nil, context.Canceled
+			},
+		},
+	}
+
+	//lint:ignore SA1012 intentionally passing a nil Context below to
+	// trigger the error return from http.NewRequestWithContext internally
+	_, err := pwnedClient.doRequest(nil, &pwnedResultBuffer{}, []byte("ABCDE"))
+	if err.Error() != "net/http: nil Context" {
+		t.Errorf("Unexpected error %v", err)
+	}
+}
+
+type testPwnedCache struct {
+	AddFn      func(context.Context, []byte, [][]byte) error
+	ContainsFn func(context.Context, []byte, []byte) (bool, error)
+}
+
+func (c *testPwnedCache) Add(ctx context.Context, prefix []byte, suffixes [][]byte) error {
+	return c.AddFn(ctx, prefix, suffixes)
+}
+
+func (c *testPwnedCache) Contains(ctx context.Context, prefix []byte, suffix []byte) (bool, error) {
+	return c.ContainsFn(ctx, prefix, suffix)
+}
+
+type countingCache struct {
+	calls int
+}
+
+func (c *countingCache) Add(ctx context.Context, prefix []byte, suffixes [][]byte) error {
+	c.calls += 1
+	return nil
+}
+
+func (c *countingCache) Contains(ctx context.Context, prefix, suffix []byte) (bool, error) {
+	c.calls += 1
+	return false, nil
+}
+
+func TestCheckWithCanceledContext(t *testing.T) {
+	calls := 0
+	hashes := 0
+	cache := &countingCache{}
+
+	pwnedClient := PwnedClient{
+		Cache: cache,
+		HTTP:  testStatusSequenceClient(&calls, []int{http.StatusOK}, nil),
+		Hasher: func(password string) string {
+			hashes += 1
+			return "E38AD214943DAAD1D64C102FAEC29DE4AFE9DA3D"
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	checks := []func() error{
+		func() error { _, err := pwnedClient.Check(ctx, "password1"); return err },
+		func() error { _, err := pwnedClient.CheckBytes(ctx, []byte("password1")); return err },
+		func() error { _, err := pwnedClient.Lookup(ctx, "password1"); return err },
+		func() error { _, err := pwnedClient.CheckCount(ctx, "password1"); return err },
+		func() error { _, err := pwnedClient.CheckCountString(ctx, "password1"); return err },
+		func() error {
+			_, err := pwnedClient.CheckHash(ctx, "E38AD214943DAAD1D64C102FAEC29DE4AFE9DA3D")
+			return err
+		},
+		func() error {
+			_, err := pwnedClient.CheckNTLMHash(ctx, "8846F7EAEE8FB117AD06BDD830B7586C")
+			return err
+		},
+	}
+
+	for i, check := range checks {
+		if err := check(); !errors.Is(err, context.Canceled) {
+			t.Errorf("Unexpected error for check %d %v", i, err)
+		}
+	}
+
+	if calls != 0 || hashes != 0 || cache.calls != 0 {
+		t.Errorf("Expected no work, got %d requests %d hashes %d cache calls", calls, hashes, cache.calls)
+	}
+}
+
+func TestCheckWithNilContext(t *testing.T) {
+	pwnedClient := PwnedClient{
+		HTTP: &testHTTPClient{
+			Fn: func(r *http.Request) (*http.Response, error) {
+				return &http.Response{
+					StatusCode: http.StatusOK,
+					Status:     "200 OK",
+					Request:    r,
+					Body:       io.NopCloser(bytes.NewReader([]byte("214943DAAD1D64C102FAEC29DE4AFE9DA3D:1\r\n"))),
+				}, nil
+			},
+		},
+	}
+
+	//lint:ignore SA1012 intentionally passing nil Context to check that
+	// the function will use context.Background() properly
+	_, err := pwnedClient.Check(nil, "password1")
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+		return
+	}
+}
+
+func TestPwnedCache(t *testing.T) {
+	addCalls := 0
+	containsCalls := 0
+	httpCalls := 0
+
+	var prefix []byte
+	var suffixes [][]byte
+
+	pwnedClient := PwnedClient{
+		Cache: &testPwnedCache{
+			AddFn: func(ctx context.Context, addPrefix []byte, addSuffixes [][]byte) error {
+				addCalls += 1
+
+				prefix = make([]byte, len(addPrefix))
+				copy(prefix, addPrefix)
+
+				suffixes = make([][]byte, len(addSuffixes))
+				for i := range addSuffixes {
+					suffixes[i] = make([]byte, len(addSuffixes[i]))
+					copy(suffixes[i], addSuffixes[i])
+				}
+
+				return nil
+			},
+			ContainsFn: func(ctx context.Context, containsPrefix, containsSuffix []byte) (bool, error) {
+				containsCalls += 1
+
+				if !bytes.Equal(containsPrefix, prefix) {
+					return false, nil
+				}
+
+				for _, suffix := range suffixes {
+					if bytes.Equal(containsSuffix, suffix) {
+						return true, nil
+					}
+				}
+
+				return false, nil
+			},
+		},
+		HTTP: &testHTTPClient{
+			Fn: func(r *http.Request) (*http.Response, error) {
+				httpCalls += 1
+
+				return &http.Response{
+					StatusCode: http.StatusOK,
+					Status:     "200 OK",
+					Request:    r,
+					Body:       io.NopCloser(bytes.NewReader([]byte("214943DAAD1D64C102FAEC29DE4AFE9DA3D:1\r\n"))),
+				}, nil
+			},
+		},
+	}
+
+	res, err := pwnedClient.Check(context.Background(), "password1")
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+		return
+	}
+
+	if !res {
+		t.Error("Expected to find the password, but didn't")
+	}
+
+	if addCalls != 1 {
+		t.Errorf("Add was called %d times, but was supposed to be called once", addCalls)
+	}
+
+	if containsCalls != 1 {
+		t.Errorf("Contains was called %d times, but was supposed to be called once", containsCalls)
+	}
+
+	if httpCalls != 1 {
+		t.Errorf("HTTP API was called %d times, but was supposed to be called once", httpCalls)
+	}
+
+	res, err = pwnedClient.Check(context.Background(), "password1")
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+		return
+	}
+
+	if !res {
+		t.Error("Expected to find the password, but didn't")
+	}
+
+	if addCalls != 1 {
+		t.Errorf("Add was called %d times, but was supposed to be called once", addCalls)
+	}
+
+	if containsCalls != 2 {
+		t.Errorf("Contains was called %d times, but was supposed to be called twice", containsCalls)
+	}
+
+	if httpCalls != 1 {
+		t.Errorf("HTTP API was called %d times, but was supposed to be called once", httpCalls)
+	}
+}
+
+type testCancelingReader struct {
+	io.Reader
+
+	Cancel  context.CancelFunc
+	Request *http.Request
+}
+
+func (r *testCancelingReader) Read(into []byte) (int, error) {
+	n, err := r.Reader.Read(into)
+	if err == io.EOF {
+		// the caller leaves right as the response has been received
+		r.Cancel()
+		<-r.Request.Context().Done()
+	}
+
+	return n, err
+}
+
+func (r *testCancelingReader) Close() error {
+	return nil
+}
+
+func TestPwnedCacheAddedAfterCallerCancels(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	added := make(chan error, 1)
+
+	pwnedClient := PwnedClient{
+		Cache: &testPwnedCache{
+			AddFn: func(ctx context.Context, addPrefix []byte, addSuffixes [][]byte) error {
+				added <- ctx.Err()
+
+				return nil
+			},
+			ContainsFn: func(ctx context.Context, containsPrefix, containsSuffix []byte) (bool, error) {
+				return false, nil
+			},
+		},
+		HTTP: &testHTTPClient{
+			Fn: func(r *http.Request) (*http.Response, error) {
+				return &http.Response{
+					StatusCode: http.StatusOK,
+					Status:     "200 OK",
+					Request:    r,
+					Body: &testCancelingReader{
+						Reader:  bytes.NewReader([]byte("214943DAAD1D64C102FAEC29DE4AFE9DA3D:1\r\n")),
+						Cancel:  cancel,
+						Request: r,
+					},
+				}, nil
+			},
+		},
+	}
+
+	_, err := pwnedClient.Check(ctx, "password1")
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	select {
+	case err := <-added:
+		if err != nil {
+			t.Errorf("Cache.Add was called with a canceled context %v", err)
+		}
+
+	case <-time.After(time.Second):
+		t.Errorf("Cache.Add was not called")
+	}
+}
+
+func TestPwnedCacheWithError(t *testing.T) {
+	containsCalls := 0
+
+	pwnedClient := PwnedClient{
+		Cache: &testPwnedCache{
+			AddFn: func(ctx context.Context, addPrefix []byte, addSuffixes [][]byte) error {
+				return context.Canceled
+			},
+			ContainsFn: func(ctx context.Context, containsPrefix, containsSuffix []byte) (bool, error) {
+				containsCalls += 1
+
+				if containsCalls > 1 {
+					return false, context.Canceled
+				}
+
+				return false, nil
+			},
+		},
+		HTTP: &testHTTPClient{
+			Fn: func(r *http.Request) (*http.Response, error) {
+				return &http.Response{
+					StatusCode: http.StatusOK,
+					Status:     "200 OK",
+					Request:    r,
+					Body:       io.NopCloser(bytes.NewReader([]byte("214943DAAD1D64C102FAEC29DE4AFE9DA3D:1\r\n"))),
+				}, nil
+			},
+		},
+	}
+
+	_, err := pwnedClient.Check(context.Background(), "password1")
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Unexpected error %v", err)
+		return
+	}
+
+	_, err = pwnedClient.Check(context.Background(), "password1")
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Unexpected error %v", err)
+		return
+	}
+}
+
+func TestCheckCount(t *testing.T) {
+	pwnedClient := PwnedClient{
+		Cache: &testPwnedCache{
+			AddFn: func(ctx context.Context, prefix []byte, suffixes [][]byte) error {
+				return nil
+			},
+			ContainsFn: func(ctx context.Context, prefix, suffix []byte) (bool, error) {
+				t.Errorf("Cache was consulted for a count")
+
+				return true, nil
+			},
+		},
+		HTTP: &testHTTPClient{
+			Fn: func(r *http.Request) (*http.Response, error) {
+				return &http.Response{
+					StatusCode: http.StatusOK,
+					Status:     "200 OK",
+					Request:    r,
+					Body:       io.NopCloser(bytes.NewReader([]byte("0123456789ABCDEF0123456789ABCDEF012:3\r\n214943DAAD1D64C102FAEC29DE4AFE9DA3D:2418984\r\n"))),
+				}, nil
+			},
+		},
+	}
+
+	count, err := pwnedClient.CheckCount(context.Background(), "password1")
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	if count != 2418984 {
+		t.Errorf("Unexpected count %d", count)
+	}
+
+	count, err = pwnedClient.CheckCount(context.Background(), "not pwned")
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	if count != 0 {
+		t.Errorf("Unexpected count %d", count)
+	}
+}
+
+func TestPwnedResultLookupCount(t *testing.T) {
+	buf := &pwnedResultBuffer{
+		Buffer: bytes.NewBuffer(nil),
+	}
+
+	if err := buf.ParseFrom(bytes.NewReader([]byte("1123456789ABCDEF0123456789ABCDEF012:7\n0123456789ABCDEF0123456789ABCDEF012:42\n2123456789ABCDEF0123456789ABCDEF012:0\n"))); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	expected := map[string]int{
+		"0123456789ABCDEF0123456789ABCDEF012": 42,
+		"1123456789ABCDEF0123456789ABCDEF012": 7,
+		"2123456789ABCDEF0123456789ABCDEF012": 0,
+		"3123456789ABCDEF0123456789ABCDEF012": 0,
+	}
+
+	for suffix, count := range expected {
+		if buf.LookupCount([]byte(suffix)) != count {
+			t.Errorf("Unexpected count for %q %d expected %d", suffix, buf.LookupCount([]byte(suffix)), count)
+		}
+	}
+}
+
+func TestCheckHash(t *testing.T) {
+	var url string
+
+	pwnedClient := PwnedClient{
+		Mode: ModeNTLM,
+		HTTP: &testHTTPClient{
+			Fn: func(r *http.Request) (*http.Response, error) {
+				url = r.URL.String()
+
+				return &http.Response{
+					StatusCode: http.StatusOK,
+					Status:     "200 OK",
+					Request:    r,
+					Body:       io.NopCloser(bytes.NewReader([]byte("214943DAAD1D64C102FAEC29DE4AFE9DA3D:1\r\n"))),
+				}, nil
+			},
+		},
+	}
+
+	res, err := pwnedClient.CheckHash(context.Background(), "e38ad214943daad1d64c102faec29de4afe9da3d")
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
 
 	if !res {
-		t.Error("Expected to find the password, but didn't")
+		t.Errorf("Expected result to be true, but was false")
+	}
+
+	if url != "https://api.pwnedpasswords.com/range/E38AD" {
+		t.Errorf("Unexpected URL %q", url)
+	}
+
+	url = ""
+
+	for _, hash := range []string{"", "E38AD", "E38AD214943DAAD1D64C102FAEC29DE4AFE9DA3", "E38AD214943DAAD1D64C102FAEC29DE4AFE9DA3DA", "X38AD214943DAAD1D64C102FAEC29DE4AFE9DA3D"} {
+		_, err := pwnedClient.CheckHash(context.Background(), hash)
+
+		var eih *ErrorInvalidHash
+		if !errors.As(err, &eih) {
+			t.Errorf("Expected ErrorInvalidHash for %q, got %v", hash, err)
+		}
+	}
+
+	if url != "" {
+		t.Errorf("Request was sent for an invalid hash")
+	}
+}
+
+func TestCheckCountString(t *testing.T) {
+	pwnedClient := PwnedClient{
+		HTTP: &testHTTPClient{
+			Fn: func(r *http.Request) (*http.Response, error) {
+				return &http.Response{
+					StatusCode: http.StatusOK,
+					Status:     "200 OK",
+					Request:    r,
+					Body:       io.NopCloser(bytes.NewReader([]byte("0123456789ABCDEF0123456789ABCDEF012:3\r\n214943DAAD1D64C102FAEC29DE4AFE9DA3D:123456789012345678901234567890\r\n"))),
+				}, nil
+			},
+		},
+	}
+
+	count, err := pwnedClient.CheckCountString(context.Background(), "password1")
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	if count != "123456789012345678901234567890" {
+		t.Errorf("Unexpected count %q", count)
+	}
+
+	count, err = pwnedClient.CheckCountString(context.Background(), "not pwned")
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	if count != "0" {
+		t.Errorf("Unexpected count %q", count)
+	}
+}
+
+func TestOnServerDate(t *testing.T) {
+	var datePrefix string
+	var date time.Time
+
+	pwnedClient := PwnedClient{
+		OnServerDate: func(prefix string, serverDate time.Time) {
+			datePrefix = prefix
+			date = serverDate
+		},
+		HTTP: &testHTTPClient{
+			Fn: func(r *http.Request) (*http.Response, error) {
+				return &http.Response{
+					StatusCode: http.StatusOK,
+					Status:     "200 OK",
+					Request:    r,
+					Header: http.Header{
+						"Date": []string{"Tue, 15 Nov 1994 08:12:31 GMT"},
+					},
+					Body: io.NopCloser(bytes.NewReader([]byte("214943DAAD1D64C102FAEC29DE4AFE9DA3D:1\r\n"))),
+				}, nil
+			},
+		},
+	}
+
+	_, err := pwnedClient.Check(context.Background(), "password1")
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	if datePrefix != "E38AD" {
+		t.Errorf("Unexpected prefix %q", datePrefix)
+	}
+
+	if !date.Equal(time.Date(1994, time.November, 15, 8, 12, 31, 0, time.UTC)) {
+		t.Errorf("Unexpected date %v", date)
+	}
+}
+
+func TestPadding(t *testing.T) {
+	var padding string
+
+	body := &bytes.Buffer{}
+	for i := 0; i < 500; i += 1 {
+		fmt.Fprintf(body, "%035X:0\r\n", i)
+	}
+	body.WriteString("214943DAAD1D64C102FAEC29DE4AFE9DA3D:3\r\n")
+	for i := 0; i < 500; i += 1 {
+		fmt.Fprintf(body, "F%034X:0\r\n", i)
+	}
+
+	pwnedClient := PwnedClient{
+		Padding: true,
+		HTTP: &testHTTPClient{
+			Fn: func(r *http.Request) (*http.Response, error) {
+				padding = r.Header.Get("Add-Padding")
+
+				return &http.Response{
+					StatusCode: http.StatusOK,
+					Status:     "200 OK",
+					Request:    r,
+					Body:       io.NopCloser(bytes.NewReader(body.Bytes())),
+				}, nil
+			},
+		},
+	}
+
+	count, err := pwnedClient.CheckCount(context.Background(), "password1")
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	if padding != "true" {
+		t.Errorf("Unexpected Add-Padding header %q", padding)
+	}
+
+	if count != 3 {
+		t.Errorf("Unexpected count %d", count)
+	}
+
+	buf := &pwnedResultBuffer{
+		Buffer: bytes.NewBuffer(nil),
+	}
+
+	if err := buf.ParseFrom(bytes.NewReader(body.Bytes())); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if len(buf.Suffixes) != 1 || string(buf.Suffixes[0]) != "214943DAAD1D64C102FAEC29DE4AFE9DA3D" {
+		t.Errorf("Unexpected suffixes %q", buf.Suffixes)
+	}
+
+	if !buf.SuffixesSorted {
+		t.Errorf("Expected padded suffixes to be sorted")
+	}
+}
+
+func TestUserAgent(t *testing.T) {
+	var userAgent string
+
+	pwnedClient := PwnedClient{
+		UserAgent: "test",
+		HTTP: &testHTTPClient{
+			Fn: func(r *http.Request) (*http.Response, error) {
+				userAgent = r.UserAgent()
+
+				return nil, context.Canceled
+			},
+		},
+	}
+
+	_, err := pwnedClient.Check(context.Background(), "password1")
+	if err != nil && !errors.Is(err, context.Canceled) {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	if userAgent != "test" {
+		t.Errorf("Unexpected User-Agent %q", userAgent)
+	}
+}
+
+func TestUserAgentFromContext(t *testing.T) {
+	var userAgent string
+
+	pwnedClient := PwnedClient{
+		UserAgent: "test",
+		HTTP: &testHTTPClient{
+			Fn: func(r *http.Request) (*http.Response, error) {
+				userAgent = r.UserAgent()
+
+				return nil, context.Canceled
+			},
+		},
+	}
+
+	_, err := pwnedClient.Check(ContextWithUserAgent(context.Background(), "tenant"), "password1")
+	if err != nil && !errors.Is(err, context.Canceled) {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	if userAgent != "tenant" {
+		t.Errorf("Unexpected User-Agent %q", userAgent)
+	}
+
+	_, err = pwnedClient.Check(ContextWithUserAgent(context.Background(), ""), "password1")
+	if err != nil && !errors.Is(err, context.Canceled) {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	if userAgent != "test" {
+		t.Errorf("Unexpected User-Agent %q", userAgent)
+	}
+}
+
+func TestRequestHook(t *testing.T) {
+	var userAgent, signature string
+
+	pwnedClient := PwnedClient{
+		UserAgent: "test",
+		RequestHook: func(req *http.Request) error {
+			if req.UserAgent() != "test" {
+				t.Errorf("Hook called before User-Agent was set")
+			}
+
+			req.Header.Set("User-Agent", "overridden")
+			req.Header.Set("X-Signature", "signed "+req.URL.Path)
+
+			return nil
+		},
+		HTTP: &testHTTPClient{
+			Fn: func(r *http.Request) (*http.Response, error) {
+				userAgent = r.UserAgent()
+				signature = r.Header.Get("X-Signature")
+
+				return nil, context.Canceled
+			},
+		},
+	}
+
+	_, err := pwnedClient.Check(context.Background(), "password1")
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	if userAgent != "overridden" || signature != "signed /range/E38AD" {
+		t.Errorf("Unexpected headers %q %q", userAgent, signature)
+	}
+}
+
+func TestCheckBytes(t *testing.T) {
+	var url string
+
+	pwnedClient := PwnedClient{
+		HTTP: testNTLMClient(&url),
 	}
 
-	if addCalls != 1 {
-		t.Errorf("Add was called %d times, but was supposed to be called once", addCalls)
+	password := []byte("password1")
+
+	res, err := pwnedClient.CheckBytes(context.Background(), password)
+	if err != nil || !res {
+		t.Errorf("Unexpected result %v %v", res, err)
 	}
 
-	if containsCalls != 2 {
-		t.Errorf("Contains was called %d times, but was supposed to be called twice", containsCalls)
+	if url != "https://api.pwnedpasswords.com/range/E38AD" {
+		t.Errorf("Unexpected URL %q", url)
 	}
 
-	if httpCalls != 1 {
-		t.Errorf("HTTP API was called %d times, but was supposed to be called once", httpCalls)
+	if string(password) != "password1" {
+		t.Errorf("Password was modified")
+	}
+
+	pwnedClient.Mode = ModeNTLM
+
+	res, err = pwnedClient.CheckBytes(context.Background(), []byte("password"))
+	if err != nil || !res {
+		t.Errorf("Unexpected result %v %v", res, err)
+	}
+
+	if url != "https://api.pwnedpasswords.com/range/8846F?mode=ntlm" {
+		t.Errorf("Unexpected URL %q", url)
 	}
 }
 
-func TestPwnedCacheWithError(t *testing.T) {
-	containsCalls := 0
+func TestHasher(t *testing.T) {
+	var url string
 
 	pwnedClient := PwnedClient{
-		Cache: &testPwnedCache{
-			AddFn: func(ctx context.Context, addPrefix []byte, addSuffixes [][]byte) error {
-				return context.Canceled
+		Hasher: func(password string) string {
+			if password == "fake" {
+				return "E38AD214943DAAD1D64C102FAEC29DE4AFE9DA3D"
+			}
+
+			return password
+		},
+		HTTP: testNTLMClient(&url),
+	}
+
+	res, err := pwnedClient.Check(context.Background(), "fake")
+	if err != nil || !res {
+		t.Errorf("Unexpected result %v %v", res, err)
+	}
+
+	if url != "https://api.pwnedpasswords.com/range/E38AD" {
+		t.Errorf("Unexpected URL %q", url)
+	}
+
+	res, err = pwnedClient.CheckBytes(context.Background(), []byte("fake"))
+	if err != nil || !res {
+		t.Errorf("Unexpected result %v %v", res, err)
+	}
+
+	var invalidHash *ErrorInvalidHash
+
+	_, err = pwnedClient.Check(context.Background(), "not a hash")
+	if !errors.As(err, &invalidHash) {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	_, err = pwnedClient.CheckMany(context.Background(), []string{"fake", "not a hash"}, 1)
+	if !errors.As(err, &invalidHash) {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	pwnedClient.Mode = ModeNTLM
+	pwnedClient.Hasher = func(password string) string {
+		return "8846F7EAEE8FB117AD06BDD830B7586C"
+	}
+
+	count, err := pwnedClient.CheckCount(context.Background(), "anything")
+	if err != nil || count != 5 {
+		t.Errorf("Unexpected result %v %v", count, err)
+	}
+
+	if url != "https://api.pwnedpasswords.com/range/8846F?mode=ntlm" {
+		t.Errorf("Unexpected URL %q", url)
+	}
+}
+
+func TestPwnedClientLookup(t *testing.T) {
+	calls := 0
+
+	pwnedClient := PwnedClient{
+		Cache: NewLRUCache(10),
+		HTTP:  testStatusSequenceClient(&calls, []int{http.StatusOK}, nil),
+	}
+
+	expected := []Result{
+		{Pwned: true, Count: 1, Prefix: "E38AD"},
+		{Pwned: true, Count: 1, FromCache: true, Prefix: "E38AD"},
+		{Pwned: false, Prefix: "2AA60"},
+	}
+
+	for i, password := range []string{"password1", "password1", "password2"} {
+		result, err := pwnedClient.Lookup(context.Background(), password)
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+
+		if result != expected[i] {
+			t.Errorf("Unexpected result %d %+v", i, result)
+		}
+	}
+}
+
+func TestMetricsHooks(t *testing.T) {
+	calls := 0
+
+	var requests, hits, misses []string
+
+	pwnedClient := PwnedClient{
+		Cache: NewLRUCache(10),
+		HTTP:  testStatusSequenceClient(&calls, []int{http.StatusOK}, nil),
+		OnRequest: func(prefix string, dur time.Duration, status int, err error) {
+			if status != http.StatusOK || err != nil || dur < 0 {
+				t.Errorf("Unexpected request metrics %v %d %v", dur, status, err)
+			}
+
+			requests = append(requests, prefix)
+		},
+		OnCacheHit: func(prefix string) {
+			hits = append(hits, prefix)
+		},
+		OnCacheMiss: func(prefix string) {
+			misses = append(misses, prefix)
+		},
+	}
+
+	for i := 0; i < 2; i += 1 {
+		_, err := pwnedClient.Check(context.Background(), "password1")
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+	}
+
+	if !slices.Equal(requests, []string{"E38AD"}) || !slices.Equal(misses, []string{"E38AD"}) || !slices.Equal(hits, []string{"E38AD"}) {
+		t.Errorf("Unexpected hook calls %v %v %v", requests, misses, hits)
+	}
+
+	calls = 0
+	pwnedClient.HTTP = testStatusSequenceClient(&calls, []int{http.StatusServiceUnavailable}, nil)
+	pwnedClient.OnRequest = func(prefix string, dur time.Duration, status int, err error) {
+		if prefix != "2AA60" || status != http.StatusServiceUnavailable || err != nil {
+			t.Errorf("Unexpected request metrics %q %d %v", prefix, status, err)
+		}
+	}
+
+	_, err := pwnedClient.CheckCount(context.Background(), "password2")
+
+	var unexpectedResponse *ErrorUnexpectedResponse
+	if !errors.As(err, &unexpectedResponse) {
+		t.Errorf("Unexpected error %v", err)
+	}
+}
+
+func TestGzipResponse(t *testing.T) {
+	compressed := &bytes.Buffer{}
+
+	writer := gzip.NewWriter(compressed)
+	writer.Write([]byte("0123456789ABCDEF0123456789ABCDEF012:3\r\n214943DAAD1D64C102FAEC29DE4AFE9DA3D:42\r\n"))
+	writer.Close()
+
+	for i := 0; i < 2; i += 1 {
+		var acceptEncoding string
+
+		pwnedClient := PwnedClient{
+			HTTP: &testHTTPClient{
+				Fn: func(r *http.Request) (*http.Response, error) {
+					acceptEncoding = r.Header.Get("Accept-Encoding")
+
+					return &http.Response{
+						StatusCode: http.StatusOK,
+						Status:     "200 OK",
+						Header: http.Header{
+							"Content-Encoding": []string{"gzip"},
+						},
+						Request: r,
+						Body:    io.NopCloser(bytes.NewReader(compressed.Bytes())),
+					}, nil
+				},
 			},
-			ContainsFn: func(ctx context.Context, containsPrefix, containsSuffix []byte) (bool, error) {
-				containsCalls += 1
+		}
 
-				if containsCalls > 1 {
-					return false, context.Canceled
+		count, err := pwnedClient.CheckCount(context.Background(), "password1")
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+
+		if count != 42 {
+			t.Errorf("Expected count 42, got %d", count)
+		}
+
+		if acceptEncoding != "gzip" {
+			t.Errorf("Unexpected Accept-Encoding %q", acceptEncoding)
+		}
+	}
+}
+
+func TestUnexpectedContentType(t *testing.T) {
+	for contentType, valid := range map[string]bool{
+		"":                          true,
+		"text/plain":                true,
+		"text/plain; charset=utf-8": true,
+		"text/html; charset=utf-8":  false,
+		"application/json":          false,
+		"invalid;;":                 false,
+	} {
+		pwnedClient := PwnedClient{
+			HTTP: &testHTTPClient{
+				Fn: func(r *http.Request) (*http.Response, error) {
+					return &http.Response{
+						StatusCode: http.StatusOK,
+						Status:     "200 OK",
+						Header: http.Header{
+							"Content-Type": []string{contentType},
+						},
+						Request: r,
+						Body:    io.NopCloser(bytes.NewReader([]byte("214943DAAD1D64C102FAEC29DE4AFE9DA3D:1\r\n"))),
+					}, nil
+				},
+			},
+		}
+
+		_, err := pwnedClient.Check(context.Background(), "password1")
+
+		var unexpectedContentType *ErrorUnexpectedContentType
+		if valid && err != nil {
+			t.Errorf("Unexpected error %v for Content-Type %q", err, contentType)
+		} else if !valid && (!errors.As(err, &unexpectedContentType) || unexpectedContentType.ContentType != contentType) {
+			t.Errorf("Unexpected error %v for Content-Type %q", err, contentType)
+		}
+	}
+}
+
+func TestMaxResponseBytes(t *testing.T) {
+	body := "214943DAAD1D64C102FAEC29DE4AFE9DA3D:1\r\n"
+
+	for limit, valid := range map[int64]bool{
+		int64(len(body)):     true,
+		int64(len(body) - 1): false,
+		-1:                   true,
+	} {
+		pwnedClient := PwnedClient{
+			MaxResponseBytes: limit,
+			HTTP: &testHTTPClient{
+				Fn: func(r *http.Request) (*http.Response, error) {
+					return &http.Response{
+						StatusCode: http.StatusOK,
+						Status:     "200 OK",
+						Request:    r,
+						Body:       io.NopCloser(strings.NewReader(body)),
+					}, nil
+				},
+			},
+		}
+
+		res, err := pwnedClient.Check(context.Background(), "password1")
+
+		var tooLarge *ErrorResponseTooLarge
+		if valid && (err != nil || !res) {
+			t.Errorf("Unexpected result %v %v for limit %d", res, err, limit)
+		} else if !valid && (!errors.As(err, &tooLarge) || tooLarge.Limit != limit) {
+			t.Errorf("Unexpected error %v for limit %d", err, limit)
+		}
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	pwnedClient := PwnedClient{
+		Timeout: 10 * time.Millisecond,
+		HTTP: &testHTTPClient{
+			Fn: func(r *http.Request) (*http.Response, error) {
+				select {
+				case <-r.Context().Done():
+					return nil, r.Context().Err()
+
+				case <-time.After(time.Second):
+					t.Errorf("Request was not canceled after the timeout")
+					return nil, context.Canceled
 				}
+			},
+		},
+	}
 
-				return false, nil
+	wg := &sync.WaitGroup{}
+
+	for i := 0; i < 3; i += 1 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			_, err := pwnedClient.Check(context.Background(), "password1")
+			if !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("Unexpected error %v", err)
+			}
+		}()
+	}
+
+	wg.Wait()
+}
+
+func TestBaseURL(t *testing.T) {
+	for _, baseURL := range []string{"https://mirror.example.com/range", "https://mirror.example.com/range/"} {
+		var url string
+
+		pwnedClient := PwnedClient{
+			BaseURL: baseURL,
+			HTTP: &testHTTPClient{
+				Fn: func(r *http.Request) (*http.Response, error) {
+					url = r.URL.String()
+
+					return nil, context.Canceled
+				},
 			},
+		}
+
+		_, err := pwnedClient.Check(context.Background(), "password1")
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Unexpected error %v", err)
+		}
+
+		if url != "https://mirror.example.com/range/E38AD" {
+			t.Errorf("Unexpected URL %q for base URL %q", url, baseURL)
+		}
+	}
+}
+
+func TestHeaders(t *testing.T) {
+	var header http.Header
+
+	pwnedClient := PwnedClient{
+		UserAgent: "test",
+		Headers: http.Header{
+			"Authorization": []string{"Bearer token"},
+			"X-Trace":       []string{"a", "b"},
 		},
 		HTTP: &testHTTPClient{
 			Fn: func(r *http.Request) (*http.Response, error) {
-				return &http.Response{
-					StatusCode: http.StatusOK,
-					Status:     "200 OK",
-					Request:    r,
-					Body:       io.NopCloser(bytes.NewReader([]byte("214943DAAD1D64C102FAEC29DE4AFE9DA3D:1\r\n"))),
-				}, nil
+				header = r.Header
+
+				return nil, context.Canceled
 			},
 		},
 	}
@@ -379,24 +2265,35 @@ func TestPwnedCacheWithError(t *testing.T) {
 	_, err := pwnedClient.Check(context.Background(), "password1")
 	if !errors.Is(err, context.Canceled) {
 		t.Errorf("Unexpected error %v", err)
-		return
 	}
 
+	if header.Get("Authorization") != "Bearer token" || !slices.Equal(header.Values("X-Trace"), []string{"a", "b"}) || header.Get("User-Agent") != "test" {
+		t.Errorf("Unexpected headers %v", header)
+	}
+
+	pwnedClient.Headers.Set("User-Agent", "custom")
+
 	_, err = pwnedClient.Check(context.Background(), "password1")
 	if !errors.Is(err, context.Canceled) {
 		t.Errorf("Unexpected error %v", err)
-		return
+	}
+
+	if header.Get("User-Agent") != "custom" {
+		t.Errorf("Expected User-Agent from Headers, got %q", header.Get("User-Agent"))
 	}
 }
 
-func TestUserAgent(t *testing.T) {
-	var userAgent string
+func TestRequestHookError(t *testing.T) {
+	hookErr := errors.New("unable to sign")
+	called := false
 
 	pwnedClient := PwnedClient{
-		UserAgent: "test",
+		RequestHook: func(req *http.Request) error {
+			return hookErr
+		},
 		HTTP: &testHTTPClient{
 			Fn: func(r *http.Request) (*http.Response, error) {
-				userAgent = r.UserAgent()
+				called = true
 
 				return nil, context.Canceled
 			},
@@ -404,12 +2301,12 @@ func TestUserAgent(t *testing.T) {
 	}
 
 	_, err := pwnedClient.Check(context.Background(), "password1")
-	if err != nil && !errors.Is(err, context.Canceled) {
+	if !errors.Is(err, hookErr) {
 		t.Errorf("Unexpected error %v", err)
 	}
 
-	if userAgent != "test" {
-		t.Errorf("Unexpected User-Agent %q", userAgent)
+	if called {
+		t.Errorf("Request was sent despite the hook failing")
 	}
 }
 
@@ -446,13 +2343,171 @@ func TestErrorUnexpectedResponse(t *testing.T) {
 		t.Errorf("No response present on the ErrorUnexpectedResponse object")
 	}
 
-	expectedError := "hibp: Unexpected HTTP Response \"400 Bad Request\" from GET \"https://api.pwnedpasswords.com/range/E38AD\""
+	if string(eur.Body) != "Bad Request\n" {
+		t.Errorf("Unexpected body snippet %q", eur.Body)
+	}
+
+	expectedError := "hibp: Unexpected HTTP Response \"400 Bad Request\" from GET \"https://api.pwnedpasswords.com/range/E38AD\": \"Bad Request\""
 
 	if eur.Error() != expectedError {
 		t.Errorf("Unexpected error string %q expected %q", eur.Error(), expectedError)
 	}
 }
 
+func TestErrorUnexpectedResponseBodySnippet(t *testing.T) {
+	pwnedClient := PwnedClient{
+		HTTP: &testHTTPClient{
+			Fn: func(r *http.Request) (*http.Response, error) {
+				return &http.Response{
+					StatusCode: http.StatusServiceUnavailable,
+					Status:     "503 Service Unavailable",
+					Body:       io.NopCloser(strings.NewReader(strings.Repeat("x", 4096))),
+					Request:    r,
+				}, nil
+			},
+		},
+	}
+
+	_, err := pwnedClient.Check(context.Background(), "password1")
+
+	var eur *ErrorUnexpectedResponse
+	if !errors.As(err, &eur) {
+		t.Fatalf("Expected ErrorUnexpectedResponse, got %v", err)
+	}
+
+	if string(eur.Body) != strings.Repeat("x", 512) {
+		t.Errorf("Expected a 512 byte snippet, got %d bytes", len(eur.Body))
+	}
+}
+
+func TestMalformedResponse(t *testing.T) {
+	for _, example := range []struct {
+		Body        string
+		Malformed   bool
+		Diagnostics *ResponseDiagnostics
+	}{
+		{"", false, &ResponseDiagnostics{}},
+		{"\r\n", false, &ResponseDiagnostics{Bytes: 2}},
+		{"0123456789ABCDEF0123456789ABCDEF012:0\r\n", false, &ResponseDiagnostics{Bytes: 39, Lines: 1, Entries: 1}},
+		{"214943DAAD1D64C102FAEC29DE4AFE9DA3D:1\r\n", false, nil},
+		{"<html>\n<body>Please complete the captcha</body>\n</html>\n", true, &ResponseDiagnostics{Bytes: 56, Lines: 3}},
+	} {
+		var diagnostics *ResponseDiagnostics
+
+		pwnedClient := PwnedClient{
+			OnEmptyRange: func(prefix string, diag ResponseDiagnostics) {
+				if prefix != "E38AD" {
+					t.Errorf("Unexpected prefix %q", prefix)
+				}
+
+				diagnostics = &diag
+			},
+			HTTP: &testHTTPClient{
+				Fn: func(r *http.Request) (*http.Response, error) {
+					return &http.Response{
+						StatusCode: http.StatusOK,
+						Body:       io.NopCloser(strings.NewReader(example.Body)),
+						Request:    r,
+					}, nil
+				},
+			},
+		}
+
+		_, err := pwnedClient.Check(context.Background(), "password1")
+
+		var emr *ErrorMalformedResponse
+		if malformed := errors.As(err, &emr); malformed != example.Malformed {
+			t.Errorf("Unexpected error %v for %q", err, example.Body)
+		}
+
+		if example.Malformed && (emr.Lines != 3 || emr.Bytes != int64(len(example.Body))) {
+			t.Errorf("Unexpected lines %d and bytes %d", emr.Lines, emr.Bytes)
+		}
+
+		if !reflect.DeepEqual(diagnostics, example.Diagnostics) {
+			t.Errorf("Unexpected diagnostics %+v for %q", diagnostics, example.Body)
+		}
+	}
+}
+
+func TestUnexpectedNotModified(t *testing.T) {
+	calls := 0
+
+	pwnedClient := PwnedClient{
+		HTTP: testStatusSequenceClient(&calls, []int{http.StatusNotModified}, nil),
+	}
+
+	_, err := pwnedClient.Check(context.Background(), "password1")
+
+	var eur *ErrorUnexpectedResponse
+	if !errors.As(err, &eur) || eur.Response.StatusCode != http.StatusNotModified {
+		t.Errorf("Expected ErrorUnexpectedResponse, got %v", err)
+	}
+}
+
+func TestErrorTransport(t *testing.T) {
+	failure := errors.New("connection refused")
+
+	for _, underlying := range []error{failure, context.Canceled} {
+		pwnedClient := PwnedClient{
+			HTTP: &testHTTPClient{
+				Fn: func(r *http.Request) (*http.Response, error) {
+					return nil, underlying
+				},
+			},
+		}
+
+		_, err := pwnedClient.Check(context.Background(), "password1")
+
+		var transport *ErrorTransport
+		if !errors.As(err, &transport) {
+			t.Fatalf("Unexpected error %v", err)
+		}
+
+		if transport.Prefix != "E38AD" || transport.URL != "https://api.pwnedpasswords.com/range/E38AD" || !errors.Is(err, underlying) {
+			t.Errorf("Unexpected error %v", err)
+		}
+	}
+}
+
+func TestValidatePrefixMatch(t *testing.T) {
+	pwnedClient := PwnedClient{
+		ValidatePrefixMatch: true,
+		HTTP: &testHTTPClient{
+			Fn: func(r *http.Request) (*http.Response, error) {
+				served := r
+
+				if r.URL.Path == "/range/E38AD" {
+					// simulate a proxy redirecting to another prefix
+					served = r.Clone(r.Context())
+					served.URL.Path = "/range/00000"
+				}
+
+				return &http.Response{
+					StatusCode: http.StatusOK,
+					Status:     "200 OK",
+					Request:    served,
+					Body:       io.NopCloser(bytes.NewReader([]byte("214943DAAD1D64C102FAEC29DE4AFE9DA3D:1\r\n"))),
+				}, nil
+			},
+		},
+	}
+
+	_, err := pwnedClient.Check(context.Background(), "password1")
+
+	var epm *ErrorPrefixMismatch
+	if !errors.As(err, &epm) {
+		t.Errorf("Expected ErrorPrefixMismatch, got %v", err)
+	} else if epm.Error() != "hibp: Response for prefix \"E38AD\" was served from \"https://api.pwnedpasswords.com/range/00000\"" {
+		t.Errorf("Unexpected error string %q", epm.Error())
+	}
+
+	_, err = pwnedClient.Check(context.Background(), "password2")
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+}
+
 func TestEndToEnd(t *testing.T) {
 	pwnedClient := PwnedClient{
 		UserAgent: "tests for https://github.com/supabase/hibp",
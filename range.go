@@ -0,0 +1,207 @@
+package hibp
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// RangeEntry is a single suffix and its occurrence count from a response of
+// the Pwned Passwords range API.
+type RangeEntry struct {
+	// Suffix is the 35 character uppercase hex suffix of the hash.
+	Suffix string
+
+	// Count is the number of times the hash appears in breaches.
+	Count int
+}
+
+// RangeRequest returns the URL of the Pwned Passwords range API to GET for the
+// password, and the suffix of its hash to look for in the parsed response.
+// Use it with ParseRange when sending requests with your own HTTP client.
+func RangeRequest(password string) (url string, suffix string) {
+	prefix, hashSuffix := hashPassword(password)
+
+	return PwnedPasswordsURL(string(prefix)), string(hashSuffix)
+}
+
+// Range fetches the range of the hash prefix in the client's Mode and returns
+// the occurrence count of every suffix in it, such as to build an offline
+// index. The prefix must be 5 hex characters, otherwise ErrorInvalidPrefix is
+// returned. Padding lines are not included.
+func (c *PwnedClient) Range(ctx context.Context, prefix string) (map[string]int, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	normalizedPrefix, err := normalizePrefix(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var counts map[string]int
+
+	if err := c.withRange(ctx, c.Mode, normalizedPrefix, func(buf *pwnedResultBuffer) {
+		counts = make(map[string]int, len(buf.Suffixes))
+
+		for i := range buf.Suffixes {
+			counts[string(buf.Suffixes[i])] = parseCount(buf.Counts[i])
+		}
+	}); err != nil {
+		return nil, err
+	}
+
+	return counts, nil
+}
+
+// ParseRange parses a response body of the Pwned Passwords range API. Padding
+// lines with a count of 0 and lines that are not in the expected format are
+// skipped. Entries are returned sorted by suffix, as Lookup requires.
+func ParseRange(r io.Reader) ([]RangeEntry, error) {
+	buf := &pwnedResultBuffer{
+		Buffer:       bytes.NewBuffer(make([]byte, 0, 4*1024)),
+		SortSuffixes: true,
+	}
+
+	if err := buf.ParseFrom(r); err != nil {
+		return nil, err
+	}
+
+	entries := make([]RangeEntry, len(buf.Suffixes))
+
+	for i := range buf.Suffixes {
+		entries[i] = RangeEntry{
+			Suffix: string(buf.Suffixes[i]),
+			Count:  parseCount(buf.Counts[i]),
+		}
+	}
+
+	return entries, nil
+}
+
+// Lookup searches the entries for the suffix and returns its count. Entries
+// sorted by suffix, as returned by ParseRange, are searched with a binary
+// search, otherwise all entries are scanned.
+func Lookup(entries []RangeEntry, suffix string) (count int, found bool) {
+	sorted := slices.IsSortedFunc(entries, func(a, b RangeEntry) int {
+		return strings.Compare(a.Suffix, b.Suffix)
+	})
+
+	if !sorted {
+		for _, entry := range entries {
+			if entry.Suffix == suffix {
+				return entry.Count, true
+			}
+		}
+
+		return 0, false
+	}
+
+	index := sort.Search(len(entries), func(i int) bool {
+		return entries[i].Suffix >= suffix
+	})
+
+	if index < len(entries) && entries[index].Suffix == suffix {
+		return entries[index].Count, true
+	}
+
+	return 0, false
+}
+
+// CheckInSuffixes reports whether the SHA-1 hash of the password is among the
+// suffixes, such as the uppercase hex suffixes of the password's prefix kept
+// in your own storage. Sorted suffixes are searched with a binary search,
+// otherwise all suffixes are scanned. No requests are sent.
+func CheckInSuffixes(password string, suffixes [][]byte) bool {
+	_, suffix := hashPassword(password)
+
+	buf := &pwnedResultBuffer{
+		Suffixes:       suffixes,
+		SuffixesSorted: slices.IsSortedFunc(suffixes, bytes.Compare),
+	}
+
+	return buf.Lookup(suffix)
+}
+
+// RangeCountChange is a suffix whose count differs between two responses for
+// the same prefix.
+type RangeCountChange struct {
+	Suffix string
+
+	// Before is the count in the older response.
+	Before int
+
+	// After is the count in the newer response.
+	After int
+}
+
+// RangeDiff holds the differences between two responses for the same prefix.
+// All slices are sorted by suffix.
+type RangeDiff struct {
+	// Added holds entries only present in the newer response.
+	Added []RangeEntry
+
+	// Removed holds entries only present in the older response.
+	Removed []RangeEntry
+
+	// Changed holds entries present in both, but with different counts.
+	Changed []RangeCountChange
+}
+
+// DiffRanges compares the entries of an older response a with the entries of
+// a newer response b for the same prefix, such as returned by ParseRange.
+func DiffRanges(a, b []RangeEntry) RangeDiff {
+	var diff RangeDiff
+
+	before := make(map[string]int, len(a))
+	for _, entry := range a {
+		before[entry.Suffix] = entry.Count
+	}
+
+	after := make(map[string]int, len(b))
+	for _, entry := range b {
+		after[entry.Suffix] = entry.Count
+	}
+
+	for suffix, count := range after {
+		previous, ok := before[suffix]
+		if !ok {
+			diff.Added = append(diff.Added, RangeEntry{
+				Suffix: suffix,
+				Count:  count,
+			})
+		} else if previous != count {
+			diff.Changed = append(diff.Changed, RangeCountChange{
+				Suffix: suffix,
+				Before: previous,
+				After:  count,
+			})
+		}
+	}
+
+	for suffix, count := range before {
+		if _, ok := after[suffix]; !ok {
+			diff.Removed = append(diff.Removed, RangeEntry{
+				Suffix: suffix,
+				Count:  count,
+			})
+		}
+	}
+
+	sort.Slice(diff.Added, func(i, j int) bool {
+		return diff.Added[i].Suffix < diff.Added[j].Suffix
+	})
+
+	sort.Slice(diff.Removed, func(i, j int) bool {
+		return diff.Removed[i].Suffix < diff.Removed[j].Suffix
+	})
+
+	sort.Slice(diff.Changed, func(i, j int) bool {
+		return diff.Changed[i].Suffix < diff.Changed[j].Suffix
+	})
+
+	return diff
+}
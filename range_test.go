@@ -0,0 +1,220 @@
+package hibp
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseRange(t *testing.T) {
+	entries, err := ParseRange(strings.NewReader("0123456789ABCDEF0123456789ABCDEF012:3\r\n1123456789ABCDEF0123456789ABCDEF012:0\r\ninvalid\r\n2123456789ABCDEF0123456789ABCDEF012:10"))
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	expected := []RangeEntry{
+		{Suffix: "0123456789ABCDEF0123456789ABCDEF012", Count: 3},
+		{Suffix: "2123456789ABCDEF0123456789ABCDEF012", Count: 10},
+	}
+
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("Unexpected entries %v", entries)
+	}
+}
+
+func TestParseRangeSorted(t *testing.T) {
+	entries, err := ParseRange(strings.NewReader("2123456789ABCDEF0123456789ABCDEF012:10\r\n0123456789abcdef0123456789abcdef012:3\r\n"))
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	expected := []RangeEntry{
+		{Suffix: "0123456789ABCDEF0123456789ABCDEF012", Count: 3},
+		{Suffix: "2123456789ABCDEF0123456789ABCDEF012", Count: 10},
+	}
+
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("Unexpected entries %v", entries)
+	}
+}
+
+func TestDiffRanges(t *testing.T) {
+	a := []RangeEntry{
+		{Suffix: "0123456789ABCDEF0123456789ABCDEF012", Count: 3},
+		{Suffix: "1123456789ABCDEF0123456789ABCDEF012", Count: 1},
+		{Suffix: "2123456789ABCDEF0123456789ABCDEF012", Count: 5},
+	}
+
+	b := []RangeEntry{
+		{Suffix: "3123456789ABCDEF0123456789ABCDEF012", Count: 2},
+		{Suffix: "0123456789ABCDEF0123456789ABCDEF012", Count: 4},
+		{Suffix: "2123456789ABCDEF0123456789ABCDEF012", Count: 5},
+	}
+
+	diff := DiffRanges(a, b)
+
+	expected := RangeDiff{
+		Added: []RangeEntry{
+			{Suffix: "3123456789ABCDEF0123456789ABCDEF012", Count: 2},
+		},
+		Removed: []RangeEntry{
+			{Suffix: "1123456789ABCDEF0123456789ABCDEF012", Count: 1},
+		},
+		Changed: []RangeCountChange{
+			{Suffix: "0123456789ABCDEF0123456789ABCDEF012", Before: 3, After: 4},
+		},
+	}
+
+	if !reflect.DeepEqual(diff, expected) {
+		t.Errorf("Unexpected diff %+v", diff)
+	}
+
+	if diff := DiffRanges(a, a); diff.Added != nil || diff.Removed != nil || diff.Changed != nil {
+		t.Errorf("Expected empty diff, got %+v", diff)
+	}
+}
+
+func TestRangeRequest(t *testing.T) {
+	url, suffix := RangeRequest("password1")
+
+	if url != "https://api.pwnedpasswords.com/range/E38AD" {
+		t.Errorf("Unexpected URL %q", url)
+	}
+
+	if suffix != "214943DAAD1D64C102FAEC29DE4AFE9DA3D" {
+		t.Errorf("Unexpected suffix %q", suffix)
+	}
+}
+
+func TestRangeURL(t *testing.T) {
+	for _, prefix := range []string{"E38AD", "e38ad", "E38ad"} {
+		url, err := RangeURL(prefix)
+		if err != nil || url != "https://api.pwnedpasswords.com/range/E38AD" {
+			t.Errorf("Unexpected URL %q %v for prefix %q", url, err, prefix)
+		}
+	}
+
+	for _, prefix := range []string{"", "E38A", "E38AD0", "G38AD", "E38A/"} {
+		url, err := RangeURL(prefix)
+
+		var invalidPrefix *ErrorInvalidPrefix
+		if !errors.As(err, &invalidPrefix) || url != "" {
+			t.Errorf("Unexpected URL %q %v for prefix %q", url, err, prefix)
+		}
+	}
+
+	if url := PwnedPasswordsURL("e38ad"); url != "https://api.pwnedpasswords.com/range/E38AD" {
+		t.Errorf("Unexpected URL %q", url)
+	}
+}
+
+func TestLookup(t *testing.T) {
+	sorted := []RangeEntry{
+		{Suffix: "0123456789ABCDEF0123456789ABCDEF012", Count: 3},
+		{Suffix: "1123456789ABCDEF0123456789ABCDEF012", Count: 1},
+		{Suffix: "2123456789ABCDEF0123456789ABCDEF012", Count: 5},
+	}
+
+	unsorted := []RangeEntry{
+		sorted[2],
+		sorted[0],
+		sorted[1],
+	}
+
+	for _, entries := range [][]RangeEntry{sorted, unsorted, nil} {
+		for _, expected := range entries {
+			count, found := Lookup(entries, expected.Suffix)
+			if !found || count != expected.Count {
+				t.Errorf("Unexpected result for %q %d %v", expected.Suffix, count, found)
+			}
+		}
+
+		count, found := Lookup(entries, "3123456789ABCDEF0123456789ABCDEF012")
+		if found || count != 0 {
+			t.Errorf("Found suffix that does not exist")
+		}
+	}
+}
+
+func TestParseRangeLookup(t *testing.T) {
+	url, suffix := RangeRequest("password1")
+	if !strings.HasSuffix(url, "/E38AD") {
+		t.Fatalf("Unexpected URL %q", url)
+	}
+
+	entries, err := ParseRange(strings.NewReader("0123456789ABCDEF0123456789ABCDEF012:3\r\n214943DAAD1D64C102FAEC29DE4AFE9DA3D:42\r\n"))
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	count, found := Lookup(entries, suffix)
+	if !found || count != 42 {
+		t.Errorf("Unexpected result %d %v", count, found)
+	}
+}
+
+func TestPwnedClientRange(t *testing.T) {
+	called := int32(0)
+
+	pwnedClient := PwnedClient{
+		HTTP: testRangeClient(&called, map[string]string{
+			"/range/E38AD": "0123456789ABCDEF0123456789ABCDEF012:3\r\n1123456789ABCDEF0123456789ABCDEF012:0\r\n214943DAAD1D64C102FAEC29DE4AFE9DA3D:42\r\n",
+		}),
+	}
+
+	counts, err := pwnedClient.Range(context.Background(), "e38ad")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	expected := map[string]int{
+		"0123456789ABCDEF0123456789ABCDEF012": 3,
+		"214943DAAD1D64C102FAEC29DE4AFE9DA3D": 42,
+	}
+
+	if !reflect.DeepEqual(counts, expected) {
+		t.Errorf("Unexpected counts %v", counts)
+	}
+
+	for _, prefix := range []string{"E38A", "E38AD0", "G38AD"} {
+		_, err := pwnedClient.Range(context.Background(), prefix)
+
+		var invalidPrefix *ErrorInvalidPrefix
+		if !errors.As(err, &invalidPrefix) {
+			t.Errorf("Unexpected error %v for prefix %q", err, prefix)
+		}
+	}
+
+	if called != 1 {
+		t.Errorf("Expected 1 HTTP call, got %d", called)
+	}
+}
+
+func TestCheckInSuffixes(t *testing.T) {
+	suffixes := [][]byte{
+		[]byte("0123456789ABCDEF0123456789ABCDEF012"),
+		[]byte("214943DAAD1D64C102FAEC29DE4AFE9DA3D"),
+		[]byte("A123456789ABCDEF0123456789ABCDEF012"),
+	}
+
+	if !CheckInSuffixes("password1", suffixes) {
+		t.Errorf("Expected password1 to be found")
+	}
+
+	if CheckInSuffixes("password2", suffixes) {
+		t.Errorf("Expected password2 not to be found")
+	}
+
+	// unsorted suffixes are scanned
+	suffixes[0], suffixes[2] = suffixes[2], suffixes[0]
+
+	if !CheckInSuffixes("password1", suffixes) {
+		t.Errorf("Expected password1 to be found in unsorted suffixes")
+	}
+
+	if CheckInSuffixes("password1", nil) {
+		t.Errorf("Expected password1 not to be found in no suffixes")
+	}
+}
@@ -0,0 +1,253 @@
+package hibp
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+)
+
+// CheckInput is a single password to check in a report. Only ID is ever
+// written to the report.
+type CheckInput struct {
+	// ID is an opaque identifier written to the report in place of the
+	// password.
+	ID string
+
+	// Password is the plaintext password to check.
+	Password string
+
+	// Hash, used when Password is empty, is the hex hash of the password
+	// in the Mode of the client.
+	Hash string
+}
+
+// Report columns that can be selected with WithReportColumns.
+const (
+	ReportColumnID    = "id"
+	ReportColumnPwned = "pwned"
+	ReportColumnCount = "count"
+	ReportColumnError = "error"
+)
+
+type reportConfig struct {
+	columns     []string
+	header      bool
+	concurrency int
+}
+
+// ReportOption configures ReportCSV.
+type ReportOption func(*reportConfig)
+
+// WithReportColumns selects the columns and their order in the report. The
+// default is id, pwned, count.
+func WithReportColumns(columns ...string) ReportOption {
+	return func(config *reportConfig) {
+		config.columns = columns
+	}
+}
+
+// WithReportHeader sets whether a header row with the column names is
+// written. The default is true.
+func WithReportHeader(header bool) ReportOption {
+	return func(config *reportConfig) {
+		config.header = header
+	}
+}
+
+// WithReportConcurrency sets the maximum number of passwords checked
+// concurrently.
+func WithReportConcurrency(concurrency int) ReportOption {
+	return func(config *reportConfig) {
+		config.concurrency = concurrency
+	}
+}
+
+// ReportCSV checks the passwords received from rows until it is closed, and
+// writes a CSV row with the result of each to out as soon as it completes, so
+// rows are not necessarily in input order. Only the caller-supplied ID of each
+// input is written, never the password or its hash. Passwords are checked
+// concurrently as with CheckCount, and concurrent checks sharing a prefix
+// result in a single request.
+//
+// Inputs whose check fails are only written if the error column is selected,
+// otherwise they are skipped. All errors are returned joined once rows is
+// closed, or the context's error if it was canceled first.
+func (c *PwnedClient) ReportCSV(ctx context.Context, rows <-chan CheckInput, out io.Writer, opts ...ReportOption) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	config := reportConfig{
+		columns:     []string{ReportColumnID, ReportColumnPwned, ReportColumnCount},
+		header:      true,
+		concurrency: defaultBatchConcurrency,
+	}
+
+	for _, opt := range opts {
+		opt(&config)
+	}
+
+	writeErrors := false
+
+	for _, column := range config.columns {
+		switch column {
+		case ReportColumnID, ReportColumnPwned, ReportColumnCount:
+		case ReportColumnError:
+			writeErrors = true
+		default:
+			return fmt.Errorf("hibp: Unknown report column %q", column)
+		}
+	}
+
+	writer := csv.NewWriter(out)
+
+	if config.header {
+		writer.Write(config.columns)
+		writer.Flush()
+
+		if err := writer.Error(); err != nil {
+			return err
+		}
+	}
+
+	type result struct {
+		id    string
+		count int
+		err   error
+	}
+
+	results := make(chan result)
+	written := make(chan error, 1)
+
+	go func() {
+		var errs []error
+		record := make([]string, len(config.columns))
+
+		for result := range results {
+			if result.err != nil {
+				errs = append(errs, fmt.Errorf("hibp: Check for %q failed: %w", result.id, result.err))
+
+				if !writeErrors {
+					continue
+				}
+			}
+
+			for i, column := range config.columns {
+				switch column {
+				case ReportColumnID:
+					record[i] = result.id
+
+				case ReportColumnPwned:
+					record[i] = strconv.FormatBool(result.err == nil && result.count > 0)
+
+				case ReportColumnCount:
+					record[i] = strconv.Itoa(result.count)
+
+				case ReportColumnError:
+					record[i] = ""
+					if result.err != nil {
+						record[i] = result.err.Error()
+					}
+				}
+			}
+
+			writer.Write(record)
+			writer.Flush()
+
+			if err := writer.Error(); err != nil {
+				errs = append(errs, err)
+
+				// drain the remaining results
+				for range results {
+				}
+			}
+		}
+
+		written <- errors.Join(errs...)
+	}()
+
+	wg := &sync.WaitGroup{}
+	sem := make(chan struct{}, max(config.concurrency, 1))
+
+	var ctxErr error
+
+reading:
+	for {
+		var input CheckInput
+		var ok bool
+
+		select {
+		case input, ok = <-rows:
+		case <-ctx.Done():
+		}
+
+		if err := ctx.Err(); err != nil {
+			ctxErr = err
+			break
+		}
+
+		if !ok {
+			break
+		}
+
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			ctxErr = ctx.Err()
+			break reading
+		}
+
+		wg.Add(1)
+		go func(input CheckInput) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			count, err := c.countInput(ctx, input)
+
+			results <- result{
+				id:    input.ID,
+				count: count,
+				err:   err,
+			}
+		}(input)
+	}
+
+	wg.Wait()
+	close(results)
+
+	err := <-written
+
+	if ctxErr != nil {
+		return ctxErr
+	}
+
+	return err
+}
+
+// countInput returns the number of times the password of the input appears
+// in breaches. Like CheckCount, the Cache is only consulted if it implements
+// CountingPwnedCache.
+func (c *PwnedClient) countInput(ctx context.Context, input CheckInput) (int, error) {
+	var prefix, suffix []byte
+	var err error
+
+	if input.Password != "" || input.Hash == "" {
+		prefix, suffix, err = c.hash(input.Password)
+	} else {
+		prefix, suffix, err = c.Mode.splitHash(input.Hash)
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	_, counting := c.Cache.(CountingPwnedCache)
+
+	result, err := c.lookup(ctx, c.Mode, prefix, suffix, counting)
+
+	return result.Count, err
+}
@@ -0,0 +1,166 @@
+package hibp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestReportCSV(t *testing.T) {
+	called := int32(0)
+
+	pwnedClient := PwnedClient{
+		HTTP: testRangeClient(&called, map[string]string{
+			"/range/E38AD": "214943DAAD1D64C102FAEC29DE4AFE9DA3D:10\r\n",
+			"/range/2AA60": "A8FF7FCD473D321E0146AFD9E26DF395147:20\r\n",
+		}),
+	}
+
+	rows := make(chan CheckInput)
+	go func() {
+		defer close(rows)
+
+		rows <- CheckInput{ID: "1", Password: "password1"}
+		rows <- CheckInput{ID: "2", Hash: "2aa60a8ff7fcd473d321e0146afd9e26df395147"}
+		rows <- CheckInput{ID: "3", Password: "password3"}
+		rows <- CheckInput{ID: "4", Hash: "invalid"}
+	}()
+
+	out := &bytes.Buffer{}
+
+	err := pwnedClient.ReportCSV(context.Background(), rows, out, WithReportColumns(ReportColumnID, ReportColumnPwned, ReportColumnCount, ReportColumnError), WithReportConcurrency(2))
+
+	var eih *ErrorInvalidHash
+	if !errors.As(err, &eih) {
+		t.Errorf("Expected ErrorInvalidHash, got %v", err)
+	}
+
+	var eur *ErrorUnexpectedResponse
+	if !errors.As(err, &eur) {
+		t.Errorf("Expected ErrorUnexpectedResponse, got %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+
+	if lines[0] != "id,pwned,count,error" {
+		t.Errorf("Unexpected header %q", lines[0])
+	}
+
+	rest := lines[1:]
+	sort.Strings(rest)
+
+	expected := []string{
+		"1,true,10,",
+		"2,true,20,",
+		"3,false,0,\"hibp: Unexpected HTTP Response \"\"503 Service Unavailable\"\" from GET \"\"https://api.pwnedpasswords.com/range/1119C\"\"\"",
+		"4,false,0,\"hibp: Invalid password hash of length 7, must be 40 hex characters\"",
+	}
+
+	if strings.Join(rest, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Unexpected report:\n%s", strings.Join(rest, "\n"))
+	}
+
+	if strings.Contains(out.String(), "password1") || strings.Contains(out.String(), "2AA60") {
+		t.Errorf("Report contains a password")
+	}
+}
+
+func TestReportCSVWithoutHeader(t *testing.T) {
+	called := int32(0)
+
+	pwnedClient := PwnedClient{
+		HTTP: testRangeClient(&called, map[string]string{
+			"/range/E38AD": "214943DAAD1D64C102FAEC29DE4AFE9DA3D:10\r\n",
+		}),
+	}
+
+	rows := make(chan CheckInput, 2)
+	rows <- CheckInput{ID: "a", Password: "password1"}
+	rows <- CheckInput{ID: "b", Password: "password2"}
+	close(rows)
+
+	out := &bytes.Buffer{}
+
+	err := pwnedClient.ReportCSV(context.Background(), rows, out, WithReportHeader(false), WithReportColumns(ReportColumnCount, ReportColumnID))
+	if err == nil {
+		t.Errorf("Expected error for failed check")
+	}
+
+	// failed checks are skipped without the error column
+	if out.String() != "10,a\n" {
+		t.Errorf("Unexpected report %q", out.String())
+	}
+
+	err = pwnedClient.ReportCSV(context.Background(), rows, out, WithReportColumns("password"))
+	if err == nil {
+		t.Errorf("Expected error for unknown column")
+	}
+}
+
+func TestReportCSVCanceled(t *testing.T) {
+	pwnedClient := PwnedClient{}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := pwnedClient.ReportCSV(ctx, make(chan CheckInput), &bytes.Buffer{})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Unexpected error %v", err)
+	}
+}
+
+func TestReportCSVWithCacheAndAudit(t *testing.T) {
+	called := int32(0)
+
+	var lock sync.Mutex
+	audited := 0
+
+	pwnedClient := PwnedClient{
+		Cache: NewLRUCache(10),
+		AuditSink: &testAuditSink{
+			RecordFn: func(ctx context.Context, prefix string, pwned bool, count int) error {
+				lock.Lock()
+				defer lock.Unlock()
+
+				audited += 1
+
+				return nil
+			},
+		},
+		HTTP: testRangeClient(&called, map[string]string{
+			"/range/E38AD": "214943DAAD1D64C102FAEC29DE4AFE9DA3D:10\r\n",
+		}),
+	}
+
+	for i := 0; i < 2; i += 1 {
+		rows := make(chan CheckInput, 1)
+		rows <- CheckInput{ID: "1", Password: "password1"}
+		close(rows)
+
+		out := &bytes.Buffer{}
+
+		if err := pwnedClient.ReportCSV(context.Background(), rows, out, WithReportHeader(false)); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+
+		if out.String() != "1,true,10\n" {
+			t.Errorf("Unexpected report %q", out.String())
+		}
+	}
+
+	if called != 1 {
+		t.Errorf("Expected the second report to be answered from the cache, got %d requests", called)
+	}
+
+	if audited != 2 {
+		t.Errorf("Expected each check to be audited, got %d", audited)
+	}
+
+	if stats := pwnedClient.Stats(); stats.Checks != 2 || stats.CacheHits != 1 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+}
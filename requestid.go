@@ -0,0 +1,39 @@
+package hibp
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+)
+
+// requestIDContextKey is the context key for the request ID set with
+// ContextWithRequestID.
+type requestIDContextKey struct{}
+
+// ContextWithRequestID returns a context that makes PwnedClient send the
+// provided request ID in the PwnedClient.RequestIDHeader header. Concurrent
+// checks that share a single request use the request ID of the check that
+// started it.
+func ContextWithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDContextKey{}, requestID)
+}
+
+// requestID returns the request ID set with ContextWithRequestID, or a new
+// random UUID (version 4) if it is not set.
+func requestID(ctx context.Context) string {
+	if requestID, _ := ctx.Value(requestIDContextKey{}).(string); requestID != "" {
+		return requestID
+	}
+
+	var id [16]byte
+
+	if _, err := rand.Read(id[:]); err != nil {
+		// crypto/rand never fails on supported platforms
+		panic(err)
+	}
+
+	id[6] = (id[6] & 0x0f) | 0x40
+	id[8] = (id[8] & 0x3f) | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", id[0:4], id[4:6], id[6:8], id[8:10], id[10:16])
+}
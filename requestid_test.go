@@ -0,0 +1,58 @@
+package hibp
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"regexp"
+	"testing"
+)
+
+func TestRequestIDHeader(t *testing.T) {
+	var requestID string
+
+	pwnedClient := PwnedClient{
+		RequestIDHeader: "X-Request-ID",
+		HTTP: &testHTTPClient{
+			Fn: func(r *http.Request) (*http.Response, error) {
+				requestID = r.Header.Get("X-Request-ID")
+
+				return nil, context.Canceled
+			},
+		},
+	}
+
+	_, err := pwnedClient.Check(ContextWithRequestID(context.Background(), "abc"), "password1")
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	if requestID != "abc" {
+		t.Errorf("Unexpected request ID %q", requestID)
+	}
+
+	_, err = pwnedClient.Check(context.Background(), "password1")
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	if !regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`).MatchString(requestID) {
+		t.Errorf("Unexpected generated request ID %q", requestID)
+	}
+}
+
+func TestNoRequestIDHeader(t *testing.T) {
+	pwnedClient := PwnedClient{
+		HTTP: &testHTTPClient{
+			Fn: func(r *http.Request) (*http.Response, error) {
+				if len(r.Header) != 2 {
+					t.Errorf("Unexpected headers %v", r.Header)
+				}
+
+				return nil, context.Canceled
+			},
+		},
+	}
+
+	pwnedClient.Check(ContextWithRequestID(context.Background(), "abc"), "password1")
+}
@@ -0,0 +1,165 @@
+package hibp
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Backoff computes how long to wait before retrying a request.
+type Backoff interface {
+	// Next returns the delay before the retry attempt, starting at 1.
+	Next(attempt int) time.Duration
+}
+
+// ExponentialBackoff doubles the delay with every attempt, starting at Base
+// and never exceeding Max.
+type ExponentialBackoff struct {
+	// Base is the delay before the first retry.
+	Base time.Duration
+
+	// Max, when positive, caps the delay.
+	Max time.Duration
+}
+
+// Next returns Base * 2^(attempt-1), capped at Max.
+func (b ExponentialBackoff) Next(attempt int) time.Duration {
+	delay := b.Base
+
+	for i := 1; i < attempt; i += 1 {
+		delay *= 2
+
+		if b.Max > 0 && delay >= b.Max {
+			return b.Max
+		}
+	}
+
+	if b.Max > 0 && delay > b.Max {
+		return b.Max
+	}
+
+	return delay
+}
+
+// FullJitterBackoff is like ExponentialBackoff, but waits a random delay
+// between 0 and the exponential delay, so that retries of many instances
+// failing at the same time are spread out instead of hitting the API in
+// lockstep.
+type FullJitterBackoff struct {
+	// Base is the maximum delay before the first retry.
+	Base time.Duration
+
+	// Max, when positive, caps the maximum delay.
+	Max time.Duration
+
+	// Rand, when set, returns a random number in [0, n), such as from a
+	// seeded source for deterministic tests. It must be safe for
+	// concurrent use. If not set, math/rand is used.
+	Rand func(n int64) int64
+}
+
+// Next returns a random delay in [0, Base * 2^(attempt-1)], capped at Max.
+func (b FullJitterBackoff) Next(attempt int) time.Duration {
+	delay := ExponentialBackoff{
+		Base: b.Base,
+		Max:  b.Max,
+	}.Next(attempt)
+
+	if delay <= 0 {
+		return 0
+	}
+
+	random := b.Rand
+	if random == nil {
+		random = rand.Int63n
+	}
+
+	return time.Duration(random(int64(delay) + 1))
+}
+
+// defaultBackoff is used when PwnedClient.Backoff is not set.
+var defaultBackoff Backoff = ExponentialBackoff{
+	Base: 250 * time.Millisecond,
+	Max:  10 * time.Second,
+}
+
+// retryableStatus reports whether a response with the status code should be
+// retried.
+func retryableStatus(statusCode int) bool {
+	return statusCode == http.StatusTooManyRequests || statusCode == http.StatusServiceUnavailable
+}
+
+// doRequestWithRetries calls doRequest, retrying up to MaxRetries times on
+// 429 and 503 responses. The Retry-After header of 429 responses is honored,
+// otherwise the Backoff is used to compute the delay.
+func (c *PwnedClient) doRequestWithRetries(ctx context.Context, buf *pwnedResultBuffer, prefix []byte) (*http.Response, error) {
+	for attempt := 1; ; attempt += 1 {
+		probe, err := c.allowRequest()
+		if err != nil {
+			return nil, err
+		}
+
+		res, err := c.doRequest(ctx, buf, prefix)
+		c.recordRequest(probe, res, err)
+
+		if c.Logf != nil {
+			status := 0
+			if res != nil {
+				status = res.StatusCode
+			}
+
+			c.logRequest(prefix, attempt, status, err)
+		}
+
+		if err != nil || attempt > c.MaxRetries || !retryableStatus(res.StatusCode) {
+			return res, err
+		}
+
+		c.stats.retries.Add(1)
+
+		delay := c.retryDelay(res, attempt)
+		c.logRetry(prefix, attempt, delay)
+
+		if err := sleep(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// retryDelay returns how long to wait before retrying after the response.
+func (c *PwnedClient) retryDelay(res *http.Response, attempt int) time.Duration {
+	if res.StatusCode == http.StatusTooManyRequests {
+		if delay, ok := parseRetryAfter(res.Header.Get("Retry-After"), now()); ok {
+			return delay
+		}
+	}
+
+	backoff := c.Backoff
+	if backoff == nil {
+		backoff = defaultBackoff
+	}
+
+	return backoff.Next(attempt)
+}
+
+// parseRetryAfter parses the value of a Retry-After header, which is either a
+// number of seconds or an HTTP date, relative to now.
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.ParseUint(value, 10, 32); err == nil {
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		return max(date.Sub(now), 0), true
+	}
+
+	return 0, false
+}
@@ -0,0 +1,248 @@
+package hibp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type testBackoff time.Duration
+
+func (b testBackoff) Next(attempt int) time.Duration {
+	return time.Duration(b)
+}
+
+func testStatusSequenceClient(calls *int, statuses []int, header http.Header) *testHTTPClient {
+	return &testHTTPClient{
+		Fn: func(r *http.Request) (*http.Response, error) {
+			status := statuses[min(*calls, len(statuses)-1)]
+			*calls += 1
+
+			body := []byte("214943DAAD1D64C102FAEC29DE4AFE9DA3D:1\r\n")
+			if status != http.StatusOK {
+				body = nil
+			}
+
+			return &http.Response{
+				StatusCode: status,
+				Status:     http.StatusText(status),
+				Header:     header,
+				Request:    r,
+				Body:       io.NopCloser(bytes.NewReader(body)),
+			}, nil
+		},
+	}
+}
+
+func TestRetryOnTooManyRequests(t *testing.T) {
+	calls := 0
+
+	pwnedClient := PwnedClient{
+		MaxRetries: 2,
+		Backoff:    testBackoff(time.Hour),
+		HTTP: testStatusSequenceClient(&calls, []int{http.StatusTooManyRequests, http.StatusOK}, http.Header{
+			"Retry-After": []string{"0"},
+		}),
+	}
+
+	res, err := pwnedClient.Check(context.Background(), "password1")
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	if !res {
+		t.Errorf("Expected result to be true, but was false")
+	}
+
+	if calls != 2 {
+		t.Errorf("Expected 2 calls, got %d", calls)
+	}
+}
+
+func TestRetryOnServiceUnavailable(t *testing.T) {
+	clock := useFakeClock(t)
+
+	calls := 0
+
+	pwnedClient := PwnedClient{
+		MaxRetries: 2,
+		Backoff: ExponentialBackoff{
+			Base: time.Second,
+			Max:  time.Minute,
+		},
+		HTTP: testStatusSequenceClient(&calls, []int{http.StatusServiceUnavailable}, nil),
+	}
+
+	_, err := pwnedClient.Check(context.Background(), "password1")
+
+	var eur *ErrorUnexpectedResponse
+	if !errors.As(err, &eur) || eur.Response.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expected ErrorUnexpectedResponse, got %v", err)
+	}
+
+	if calls != 3 {
+		t.Errorf("Expected 3 calls, got %d", calls)
+	}
+
+	if sleeps := clock.Sleeps(); !reflect.DeepEqual(sleeps, []time.Duration{time.Second, 2 * time.Second}) {
+		t.Errorf("Unexpected backoff %v", sleeps)
+	}
+}
+
+func TestNoRetryOnBadRequest(t *testing.T) {
+	calls := 0
+
+	pwnedClient := PwnedClient{
+		MaxRetries: 2,
+		Backoff:    testBackoff(time.Millisecond),
+		HTTP:       testStatusSequenceClient(&calls, []int{http.StatusBadRequest, http.StatusOK}, nil),
+	}
+
+	_, err := pwnedClient.Check(context.Background(), "password1")
+
+	var eur *ErrorUnexpectedResponse
+	if !errors.As(err, &eur) {
+		t.Errorf("Expected ErrorUnexpectedResponse, got %v", err)
+	}
+
+	if calls != 1 {
+		t.Errorf("Expected 1 call, got %d", calls)
+	}
+}
+
+func TestRetryCanceled(t *testing.T) {
+	calls := 0
+
+	pwnedClient := PwnedClient{
+		MaxRetries: 2,
+		Backoff:    testBackoff(time.Hour),
+		HTTP:       testStatusSequenceClient(&calls, []int{http.StatusServiceUnavailable}, nil),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err := pwnedClient.Check(ctx, "password1")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Unexpected error %v", err)
+	}
+}
+
+func TestExponentialBackoff(t *testing.T) {
+	backoff := ExponentialBackoff{
+		Base: time.Second,
+		Max:  5 * time.Second,
+	}
+
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+
+	for i, delay := range expected {
+		if backoff.Next(i+1) != delay {
+			t.Errorf("Unexpected delay for attempt %d %v expected %v", i+1, backoff.Next(i+1), delay)
+		}
+	}
+}
+
+func TestFullJitterBackoff(t *testing.T) {
+	var bounds []int64
+
+	backoff := FullJitterBackoff{
+		Base: time.Second,
+		Max:  5 * time.Second,
+		Rand: func(n int64) int64 {
+			bounds = append(bounds, n)
+
+			return n / 2
+		},
+	}
+
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second}
+
+	for i, delay := range expected {
+		if next := backoff.Next(i + 1); next != (delay+1)/2 {
+			t.Errorf("Unexpected delay for attempt %d %v expected %v", i+1, next, (delay+1)/2)
+		}
+
+		if bounds[i] != int64(delay)+1 {
+			t.Errorf("Unexpected random bound for attempt %d %d", i+1, bounds[i])
+		}
+	}
+
+	backoff.Rand = nil
+
+	for i := 0; i < 100; i += 1 {
+		if next := backoff.Next(3); next < 0 || next > 4*time.Second {
+			t.Errorf("Delay %v out of range", next)
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	examples := []struct {
+		Value string
+		Delay time.Duration
+		OK    bool
+	}{
+		{"", 0, false},
+		{"2", 2 * time.Second, true},
+		{" 120 ", 2 * time.Minute, true},
+		{"-1", 0, false},
+		{"soon", 0, false},
+		{"Mon, 01 Jan 2024 00:00:30 GMT", 30 * time.Second, true},
+		{"Sun, 31 Dec 2023 23:59:00 GMT", 0, true},
+	}
+
+	for _, example := range examples {
+		delay, ok := parseRetryAfter(example.Value, now)
+
+		if delay != example.Delay || ok != example.OK {
+			t.Errorf("Unexpected result for %q %v %v", example.Value, delay, ok)
+		}
+	}
+}
+
+func TestErrorRateLimited(t *testing.T) {
+	examples := []struct {
+		Header     http.Header
+		RetryAfter time.Duration
+	}{
+		{http.Header{"Retry-After": []string{"7"}}, 7 * time.Second},
+		{http.Header{"Retry-After": []string{"invalid"}}, DefaultRetryAfter},
+		{nil, DefaultRetryAfter},
+	}
+
+	for _, example := range examples {
+		calls := 0
+
+		pwnedClient := PwnedClient{
+			HTTP: testStatusSequenceClient(&calls, []int{http.StatusTooManyRequests}, example.Header),
+		}
+
+		_, err := pwnedClient.Check(context.Background(), "password1")
+
+		var erl *ErrorRateLimited
+		if !errors.As(err, &erl) {
+			t.Errorf("Expected ErrorRateLimited, got %v", err)
+			continue
+		}
+
+		if erl.RetryAfter != example.RetryAfter {
+			t.Errorf("Unexpected RetryAfter %v expected %v", erl.RetryAfter, example.RetryAfter)
+		}
+
+		if erl.Response == nil || erl.Response.StatusCode != http.StatusTooManyRequests {
+			t.Errorf("Unexpected response on error")
+		}
+
+		if erl.Error() != "hibp: Rate limited from GET \"https://api.pwnedpasswords.com/range/E38AD\", retry after "+example.RetryAfter.String() {
+			t.Errorf("Unexpected error string %q", erl.Error())
+		}
+	}
+}
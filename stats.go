@@ -0,0 +1,73 @@
+package hibp
+
+import (
+	"sync/atomic"
+)
+
+// Stats is a snapshot of the cumulative counters of a PwnedClient, as
+// returned by PwnedClient.Stats.
+type Stats struct {
+	// Checks is the number of passwords and hashes checked, including
+	// each one checked with CheckMany.
+	Checks int64
+
+	// CacheHits is the number of checks answered by the Cache.
+	CacheHits int64
+
+	// Fetches is the number of requests sent to the Pwned Passwords
+	// API, including retries.
+	Fetches int64
+
+	// Coalesced is the number of checks that joined an in-flight request
+	// for the same prefix instead of sending their own.
+	Coalesced int64
+
+	// Retries is the number of requests that were retried.
+	Retries int64
+
+	// Errors is the number of checks that returned an error.
+	Errors int64
+}
+
+// clientStats holds the counters of a PwnedClient.
+type clientStats struct {
+	checks    atomic.Int64
+	cacheHits atomic.Int64
+	fetches   atomic.Int64
+	coalesced atomic.Int64
+	retries   atomic.Int64
+	errors    atomic.Int64
+}
+
+// Stats returns a snapshot of the cumulative counters of the client. It is
+// cheap and safe to call concurrently with checks, though the counters are
+// read one at a time, so they may be slightly out of sync with each other.
+func (c *PwnedClient) Stats() Stats {
+	return Stats{
+		Checks:    c.stats.checks.Load(),
+		CacheHits: c.stats.cacheHits.Load(),
+		Fetches:   c.stats.fetches.Load(),
+		Coalesced: c.stats.coalesced.Load(),
+		Retries:   c.stats.retries.Load(),
+		Errors:    c.stats.errors.Load(),
+	}
+}
+
+// countChecks counts checks of n passwords, of which failed returned an error.
+func (c *PwnedClient) countChecks(n, failed int) {
+	c.stats.checks.Add(int64(n))
+
+	if failed > 0 {
+		c.stats.errors.Add(int64(failed))
+	}
+}
+
+// countCheck counts a single check that returned err.
+func (c *PwnedClient) countCheck(err error) {
+	failed := 0
+	if err != nil {
+		failed = 1
+	}
+
+	c.countChecks(1, failed)
+}
@@ -0,0 +1,91 @@
+package hibp
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestStats(t *testing.T) {
+	calls := 0
+
+	pwnedClient := PwnedClient{
+		Cache:      NewLRUCache(10),
+		MaxRetries: 1,
+		Backoff:    testBackoff(time.Millisecond),
+		HTTP: testStatusSequenceClient(&calls, []int{
+			http.StatusServiceUnavailable,
+			http.StatusOK,
+			http.StatusBadRequest,
+		}, nil),
+	}
+
+	// fetched after a retry
+	if _, err := pwnedClient.Check(context.Background(), "password1"); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	// answered by the cache
+	if _, err := pwnedClient.Check(context.Background(), "password1"); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	// fails with 400 Bad Request
+	if _, err := pwnedClient.Check(context.Background(), "password2"); err == nil {
+		t.Fatalf("Expected error")
+	}
+
+	expected := Stats{
+		Checks:    3,
+		CacheHits: 1,
+		Fetches:   3,
+		Retries:   1,
+		Errors:    1,
+	}
+
+	if stats := pwnedClient.Stats(); stats != expected {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+}
+
+func TestStatsCoalesced(t *testing.T) {
+	const checks = 10
+
+	release := make(chan struct{})
+
+	pwnedClient := PwnedClient{
+		HTTP: &testHTTPClient{
+			Fn: func(r *http.Request) (*http.Response, error) {
+				<-release
+
+				return nil, context.Canceled
+			},
+		},
+	}
+
+	wg := &sync.WaitGroup{}
+
+	for i := 0; i < checks; i += 1 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			pwnedClient.Check(context.Background(), "password1")
+		}()
+	}
+
+	for pwnedClient.Stats().Coalesced < checks-1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	close(release)
+	wg.Wait()
+
+	stats := pwnedClient.Stats()
+
+	if stats.Checks != checks || stats.Coalesced != checks-1 || stats.Fetches != 1 || stats.Errors != checks {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+}
@@ -0,0 +1,110 @@
+package hibp
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"sync"
+)
+
+// StreamResult is the result of checking a password read by CheckStream.
+type StreamResult struct {
+	// Password is the password that was checked.
+	Password string
+
+	// Pwned is true if the password was found in a breach.
+	Pwned bool
+
+	// Err is the error checking the password, or reading the stream, in
+	// which case Password is empty.
+	Err error
+}
+
+// CheckStream checks the passwords read line by line from r, such as a
+// newline-delimited password list being audited, emitting a result for each
+// non-empty line on the returned channel as soon as it is available, so not
+// necessarily in input order. LF, CRLF and bare CR line endings are accepted,
+// lines longer than 64KB result in a bufio.ErrTooLong result ending the
+// stream.
+//
+// At most concurrency checks run at a time (8 if not positive), so memory use
+// is bounded regardless of the size of the input, and concurrent checks of
+// passwords sharing a prefix result in a single request. The channel is closed
+// once all lines have been checked, or once ctx is canceled, after which
+// remaining lines are not read. Callers must receive from the channel until it
+// is closed or cancel ctx.
+func (c *PwnedClient) CheckStream(ctx context.Context, r io.Reader, concurrency int) (<-chan StreamResult, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	if r == nil {
+		return nil, errors.New("hibp: CheckStream requires a reader")
+	}
+
+	if concurrency < 1 {
+		concurrency = defaultBatchConcurrency
+	}
+
+	results := make(chan StreamResult, concurrency)
+
+	go func() {
+		defer close(results)
+
+		wg := &sync.WaitGroup{}
+		defer wg.Wait()
+
+		sem := make(chan struct{}, concurrency)
+
+		emit := func(result StreamResult) {
+			select {
+			case results <- result:
+			case <-ctx.Done():
+			}
+		}
+
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(nil, maxLineLength)
+		scanner.Split(scanLines)
+
+		for ctx.Err() == nil && scanner.Scan() {
+			password := scanner.Text()
+			if password == "" {
+				continue
+			}
+
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer func() { <-sem }()
+
+				pwned, err := c.Check(ctx, password)
+				if err != nil && ctx.Err() != nil {
+					// the stream was canceled, not the check
+					return
+				}
+
+				emit(StreamResult{
+					Password: password,
+					Pwned:    pwned,
+					Err:      err,
+				})
+			}()
+		}
+
+		if err := scanner.Err(); err != nil && ctx.Err() == nil {
+			emit(StreamResult{
+				Err: err,
+			})
+		}
+	}()
+
+	return results, nil
+}
@@ -0,0 +1,128 @@
+package hibp
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestCheckStream(t *testing.T) {
+	calls := int32(0)
+
+	pwnedClient := PwnedClient{
+		HTTP: &testHTTPClient{
+			Fn: func(r *http.Request) (*http.Response, error) {
+				atomic.AddInt32(&calls, 1)
+
+				return &http.Response{
+					StatusCode: http.StatusOK,
+					Body:       io.NopCloser(strings.NewReader("214943DAAD1D64C102FAEC29DE4AFE9DA3D:1\r\n")),
+					Request:    r,
+				}, nil
+			},
+		},
+	}
+
+	input := "password1\r\npassword2\n\npassword1\rpassword3"
+
+	results, err := pwnedClient.CheckStream(context.Background(), strings.NewReader(input), 2)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	pwned := make(map[string]int)
+	clean := make(map[string]int)
+
+	for result := range results {
+		if result.Err != nil {
+			t.Errorf("Unexpected error %v", result.Err)
+		}
+
+		if result.Pwned {
+			pwned[result.Password] += 1
+		} else {
+			clean[result.Password] += 1
+		}
+	}
+
+	if len(pwned) != 1 || pwned["password1"] != 2 {
+		t.Errorf("Unexpected pwned results %v", pwned)
+	}
+
+	if len(clean) != 2 || clean["password2"] != 1 || clean["password3"] != 1 {
+		t.Errorf("Unexpected clean results %v", clean)
+	}
+
+	if calls < 3 || calls > 4 {
+		t.Errorf("Unexpected number of requests %d", calls)
+	}
+}
+
+func TestCheckStreamLineTooLong(t *testing.T) {
+	pwnedClient := PwnedClient{
+		HTTP: testStatusSequenceClient(new(int), []int{http.StatusOK}, nil),
+	}
+
+	results, err := pwnedClient.CheckStream(context.Background(), strings.NewReader(strings.Repeat("x", maxLineLength+1)), 1)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	var errs []error
+	for result := range results {
+		errs = append(errs, result.Err)
+	}
+
+	if len(errs) != 1 || !errors.Is(errs[0], bufio.ErrTooLong) {
+		t.Errorf("Unexpected results %v", errs)
+	}
+}
+
+func TestCheckStreamCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	pwnedClient := PwnedClient{
+		HTTP: &testHTTPClient{
+			Fn: func(r *http.Request) (*http.Response, error) {
+				<-r.Context().Done()
+
+				return nil, r.Context().Err()
+			},
+		},
+	}
+
+	// an endless stream of passwords
+	reader := readerFunc(func(p []byte) (int, error) {
+		return copy(p, "password\n"), nil
+	})
+
+	results, err := pwnedClient.CheckStream(ctx, reader, 4)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	cancel()
+
+	// the channel is closed despite the endless stream and the checks
+	// that never complete on their own
+	for result := range results {
+		if result.Err != nil {
+			t.Errorf("Unexpected error %v", result.Err)
+		}
+	}
+
+	if _, err := pwnedClient.CheckStream(ctx, nil, 1); err == nil {
+		t.Errorf("Expected error for a nil reader")
+	}
+}
+
+type readerFunc func(p []byte) (int, error)
+
+func (f readerFunc) Read(p []byte) (int, error) {
+	return f(p)
+}
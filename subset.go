@@ -0,0 +1,79 @@
+package hibp
+
+import (
+	"context"
+	"sort"
+)
+
+// PwnedPassword is a password found in a breach, along with the number of
+// times it appears in breaches.
+type PwnedPassword struct {
+	Password string
+	Count    int
+}
+
+// PwnedSubset checks the passwords and returns only those found in a breach,
+// deduplicated and sorted by the number of times they appear in breaches in
+// descending order. See PwnedSubsetCounts for details.
+func (c *PwnedClient) PwnedSubset(ctx context.Context, passwords []string) ([]string, error) {
+	pwned, err := c.PwnedSubsetCounts(ctx, passwords, 0)
+
+	subset := make([]string, len(pwned))
+	for i := range pwned {
+		subset[i] = pwned[i].Password
+	}
+
+	return subset, err
+}
+
+// PwnedSubsetCounts checks the passwords and returns those found in a breach
+// along with their counts, deduplicated and sorted by count in descending
+// order (ties are sorted by password). When limit is positive, at most limit
+// passwords are returned. Passwords are checked as with CheckMany, but the
+// Cache is only consulted if it implements CountingPwnedCache, as with
+// CheckCount. If some ranges could not be fetched, the passwords found in the
+// others are returned along with all errors joined.
+func (c *PwnedClient) PwnedSubsetCounts(ctx context.Context, passwords []string, limit int) ([]PwnedPassword, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	unique := make([]string, 0, len(passwords))
+	seen := make(map[string]struct{}, len(passwords))
+
+	for _, password := range passwords {
+		if _, ok := seen[password]; ok {
+			continue
+		}
+
+		seen[password] = struct{}{}
+		unique = append(unique, password)
+	}
+
+	counts, err := c.countMany(ctx, unique, defaultBatchConcurrency)
+
+	var pwned []PwnedPassword
+
+	for i, count := range counts {
+		if count > 0 {
+			pwned = append(pwned, PwnedPassword{
+				Password: unique[i],
+				Count:    count,
+			})
+		}
+	}
+
+	sort.Slice(pwned, func(i, j int) bool {
+		if pwned[i].Count != pwned[j].Count {
+			return pwned[i].Count > pwned[j].Count
+		}
+
+		return pwned[i].Password < pwned[j].Password
+	})
+
+	if limit > 0 && len(pwned) > limit {
+		pwned = pwned[:limit]
+	}
+
+	return pwned, err
+}
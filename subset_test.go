@@ -0,0 +1,131 @@
+package hibp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"reflect"
+	"sync/atomic"
+	"testing"
+)
+
+func testRangeClient(called *int32, ranges map[string]string) *testHTTPClient {
+	return &testHTTPClient{
+		Fn: func(r *http.Request) (*http.Response, error) {
+			atomic.AddInt32(called, 1)
+
+			body, ok := ranges[r.URL.Path]
+			if !ok {
+				return &http.Response{
+					StatusCode: http.StatusServiceUnavailable,
+					Status:     "503 Service Unavailable",
+					Request:    r,
+					Body:       io.NopCloser(bytes.NewReader(nil)),
+				}, nil
+			}
+
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Status:     "200 OK",
+				Request:    r,
+				Body:       io.NopCloser(bytes.NewReader([]byte(body))),
+			}, nil
+		},
+	}
+}
+
+func TestPwnedSubset(t *testing.T) {
+	called := int32(0)
+
+	pwnedClient := PwnedClient{
+		// password1 is E38AD214943DAAD1D64C102FAEC29DE4AFE9DA3D
+		// password2 is 2AA60A8FF7FCD473D321E0146AFD9E26DF395147
+		// password3 is 1119CFD37EE247357E034A08D844EEA25F6FD20F (not present)
+		HTTP: testRangeClient(&called, map[string]string{
+			"/range/E38AD": "214943DAAD1D64C102FAEC29DE4AFE9DA3D:10\r\n",
+			"/range/2AA60": "A8FF7FCD473D321E0146AFD9E26DF395147:20\r\n",
+			"/range/1119C": "0123456789ABCDEF0123456789ABCDEF012:1\r\n",
+		}),
+	}
+
+	passwords := []string{"password1", "password3", "password2", "password1"}
+
+	subset, err := pwnedClient.PwnedSubset(context.Background(), passwords)
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	if !reflect.DeepEqual(subset, []string{"password2", "password1"}) {
+		t.Errorf("Unexpected subset %v", subset)
+	}
+
+	if called != 3 {
+		t.Errorf("Expected 3 requests, got %d", called)
+	}
+
+	counts, err := pwnedClient.PwnedSubsetCounts(context.Background(), passwords, 1)
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	if !reflect.DeepEqual(counts, []PwnedPassword{{"password2", 20}}) {
+		t.Errorf("Unexpected counts %v", counts)
+	}
+}
+
+func TestPwnedSubsetWithErrors(t *testing.T) {
+	called := int32(0)
+
+	pwnedClient := PwnedClient{
+		HTTP: testRangeClient(&called, map[string]string{
+			"/range/E38AD": "214943DAAD1D64C102FAEC29DE4AFE9DA3D:10\r\n",
+		}),
+	}
+
+	subset, err := pwnedClient.PwnedSubset(context.Background(), []string{"password1", "password2"})
+
+	var eur *ErrorUnexpectedResponse
+	if !errors.As(err, &eur) {
+		t.Errorf("Expected ErrorUnexpectedResponse, got %v", err)
+	}
+
+	if !reflect.DeepEqual(subset, []string{"password1"}) {
+		t.Errorf("Unexpected subset %v", subset)
+	}
+}
+
+func TestPwnedSubsetCountsWithCache(t *testing.T) {
+	called := int32(0)
+
+	pwnedClient := PwnedClient{
+		Cache: NewLRUCache(10),
+		HTTP: testRangeClient(&called, map[string]string{
+			"/range/E38AD": "214943DAAD1D64C102FAEC29DE4AFE9DA3D:10\r\n",
+			"/range/2AA60": "A8FF7FCD473D321E0146AFD9E26DF395147:20\r\n",
+		}),
+	}
+
+	passwords := []string{"password1", "password2"}
+	expected := []PwnedPassword{{"password2", 20}, {"password1", 10}}
+
+	for i := 0; i < 2; i += 1 {
+		pwned, err := pwnedClient.PwnedSubsetCounts(context.Background(), passwords, 0)
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+
+		if !reflect.DeepEqual(pwned, expected) {
+			t.Errorf("Unexpected result %v", pwned)
+		}
+	}
+
+	if called != 2 {
+		t.Errorf("Expected the second call to be answered from the cache, got %d requests", called)
+	}
+
+	if stats := pwnedClient.Stats(); stats.Checks != 4 || stats.CacheHits != 2 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+}
@@ -0,0 +1,57 @@
+package hibp
+
+import (
+	"errors"
+	"net/http"
+)
+
+// SpanResult is the result of a check passed to the function ending the span
+// started with PwnedClient.StartSpan.
+type SpanResult struct {
+	// Cached is true if the check was answered from the Cache.
+	Cached bool
+
+	// Pwned is true if the password was found in a breach.
+	Pwned bool
+
+	// Status is the status code of the response from the Pwned Passwords
+	// API, or 0 if the check was answered from the Cache or no response
+	// was received.
+	Status int
+
+	// Err is the error with which the check failed, if any.
+	Err error
+}
+
+// newSpanResult builds the SpanResult of a check, recovering the status code
+// from errors holding the response.
+func newSpanResult(cached, pwned bool, err error) SpanResult {
+	result := SpanResult{
+		Cached: cached,
+		Pwned:  pwned,
+		Err:    err,
+	}
+
+	var res *http.Response
+
+	var unexpectedResponse *ErrorUnexpectedResponse
+	var rateLimited *ErrorRateLimited
+
+	switch {
+	case cached:
+	case err == nil:
+		result.Status = http.StatusOK
+
+	case errors.As(err, &unexpectedResponse):
+		res = unexpectedResponse.Response
+
+	case errors.As(err, &rateLimited):
+		res = rateLimited.Response
+	}
+
+	if res != nil {
+		result.Status = res.StatusCode
+	}
+
+	return result
+}
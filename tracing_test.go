@@ -0,0 +1,64 @@
+package hibp
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+type testSpanKey struct{}
+
+func TestStartSpan(t *testing.T) {
+	calls := 0
+
+	var prefixes []string
+	var results []SpanResult
+
+	client := testStatusSequenceClient(&calls, []int{http.StatusOK, http.StatusServiceUnavailable}, nil)
+	sendFn := client.Fn
+
+	client.Fn = func(r *http.Request) (*http.Response, error) {
+		if r.Context().Value(testSpanKey{}) == nil {
+			t.Errorf("Request was not sent with the span context")
+		}
+
+		return sendFn(r)
+	}
+
+	pwnedClient := PwnedClient{
+		Cache: NewLRUCache(10),
+		HTTP:  client,
+		StartSpan: func(ctx context.Context, prefix string) (context.Context, func(SpanResult)) {
+			prefixes = append(prefixes, prefix)
+
+			return context.WithValue(ctx, testSpanKey{}, prefix), func(result SpanResult) {
+				results = append(results, result)
+			}
+		},
+	}
+
+	for _, password := range []string{"password1", "password1", "password2"} {
+		pwnedClient.Check(context.Background(), password)
+	}
+
+	if len(prefixes) != 3 || prefixes[0] != "E38AD" || prefixes[2] != "2AA60" {
+		t.Fatalf("Unexpected span prefixes %v", prefixes)
+	}
+
+	expected := []struct {
+		cached bool
+		pwned  bool
+		status int
+		err    bool
+	}{
+		{false, true, http.StatusOK, false},
+		{true, true, 0, false},
+		{false, false, http.StatusServiceUnavailable, true},
+	}
+
+	for i, result := range results {
+		if result.Cached != expected[i].cached || result.Pwned != expected[i].pwned || result.Status != expected[i].status || (result.Err != nil) != expected[i].err {
+			t.Errorf("Unexpected span result %d %+v", i, result)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package hibp
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// httpDoer is the interface of the HTTP client used to send requests.
+type httpDoer interface {
+	Do(*http.Request) (*http.Response, error)
+}
+
+// httpClient returns the HTTP client used to send requests: HTTP if set,
+// otherwise a client built from the transport settings on PwnedClient.
+func (c *PwnedClient) httpClient() httpDoer {
+	if c.HTTP != nil {
+		return c.HTTP
+	}
+
+	c.defaultHTTPOnce.Do(func() {
+		c.defaultHTTP = c.newDefaultHTTPClient()
+	})
+
+	return c.defaultHTTP
+}
+
+// DefaultTransport returns a new http.Transport tuned for the traffic pattern
+// of checks: bursts of requests to a single host. Compared to
+// http.DefaultTransport it keeps more idle connections to the host, so that
+// bursts reuse connections instead of opening new ones. HTTP/2 and keep-alives
+// are enabled.
+func DefaultTransport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	transport.ForceAttemptHTTP2 = true
+	transport.DisableKeepAlives = false
+	transport.MaxIdleConns = 100
+	transport.MaxIdleConnsPerHost = 32
+	transport.IdleConnTimeout = 90 * time.Second
+
+	return transport
+}
+
+// sharedHTTPClient is the client used by all PwnedClients without HTTP or
+// transport settings, so that they share connections.
+var sharedHTTPClient = sync.OnceValue(func() *http.Client {
+	return &http.Client{
+		Transport: DefaultTransport(),
+	}
+})
+
+// newDefaultHTTPClient builds the client used when HTTP is not set. If no
+// transport settings are configured, a client using DefaultTransport shared by
+// all PwnedClients is used.
+func (c *PwnedClient) newDefaultHTTPClient() *http.Client {
+	customDialer := c.ConnectTimeout != 0 || c.FallbackDelay != 0 || c.IPv4Only
+
+	customTLS := c.RootCAs != nil || len(c.PinnedPublicKeys) > 0
+
+	if !customDialer && !customTLS && c.ResponseHeaderTimeout == 0 && c.Proxy == nil {
+		return sharedHTTPClient()
+	}
+
+	transport := DefaultTransport()
+
+	if customDialer {
+		transport.DialContext = c.dialContext(c.newDialer())
+	}
+
+	transport.ResponseHeaderTimeout = c.ResponseHeaderTimeout
+
+	if c.Proxy != nil {
+		transport.Proxy = c.Proxy
+	}
+
+	if customTLS {
+		transport.TLSClientConfig = c.tlsConfig()
+	}
+
+	return &http.Client{
+		Transport: transport,
+	}
+}
+
+// DefaultConnectTimeout is how long establishing a connection may take when
+// PwnedClient.ConnectTimeout is not set, as with http.DefaultTransport.
+const DefaultConnectTimeout = 30 * time.Second
+
+// newDialer returns the dialer configured with the dialer settings on
+// PwnedClient.
+func (c *PwnedClient) newDialer() *net.Dialer {
+	timeout := c.ConnectTimeout
+	if timeout == 0 {
+		timeout = DefaultConnectTimeout
+	}
+
+	return &net.Dialer{
+		Timeout:       timeout,
+		KeepAlive:     30 * time.Second,
+		FallbackDelay: c.FallbackDelay,
+	}
+}
+
+// dialContext returns the DialContext function of the transport, dialing with
+// the dialer over IPv4 only if IPv4Only is set.
+func (c *PwnedClient) dialContext(dialer *net.Dialer) func(ctx context.Context, network, address string) (net.Conn, error) {
+	if !c.IPv4Only {
+		return dialer.DialContext
+	}
+
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		if network == "tcp" || network == "tcp6" {
+			network = "tcp4"
+		}
+
+		return dialer.DialContext(ctx, network, address)
+	}
+}
+
+// tlsConfig returns the TLS configuration of the transport, trusting RootCAs
+// and checking PinnedPublicKeys.
+func (c *PwnedClient) tlsConfig() *tls.Config {
+	config := &tls.Config{
+		RootCAs: c.RootCAs,
+	}
+
+	if len(c.PinnedPublicKeys) > 0 {
+		pins := make(map[string]bool, len(c.PinnedPublicKeys))
+		for _, pin := range c.PinnedPublicKeys {
+			pins[pin] = true
+		}
+
+		// called after the chain has been verified as usual
+		config.VerifyConnection = func(state tls.ConnectionState) error {
+			for _, chain := range state.VerifiedChains {
+				for _, cert := range chain {
+					if pins[publicKeyPin(cert)] {
+						return nil
+					}
+				}
+			}
+
+			return ErrCertificateNotPinned
+		}
+	}
+
+	return config
+}
+
+// publicKeyPin returns the pin of the public key of the certificate, as
+// listed in PwnedClient.PinnedPublicKeys.
+func publicKeyPin(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,304 @@
+package hibp
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDefaultHTTPClient(t *testing.T) {
+	pwnedClient := PwnedClient{}
+
+	client, ok := pwnedClient.httpClient().(*http.Client)
+	if !ok || client == http.DefaultClient {
+		t.Fatalf("Expected a client with DefaultTransport to be used")
+	}
+
+	if transport := client.Transport.(*http.Transport); transport.MaxIdleConnsPerHost != DefaultTransport().MaxIdleConnsPerHost {
+		t.Errorf("Unexpected MaxIdleConnsPerHost %d", transport.MaxIdleConnsPerHost)
+	}
+
+	otherClient := PwnedClient{}
+
+	if otherClient.httpClient() != client {
+		t.Errorf("Expected the default client to be shared")
+	}
+
+	httpClient := &testHTTPClient{}
+
+	pwnedClient = PwnedClient{
+		HTTP:           httpClient,
+		ConnectTimeout: time.Second,
+	}
+
+	if pwnedClient.httpClient() != httpClient {
+		t.Errorf("Expected HTTP to be used")
+	}
+}
+
+func TestTransportTimeouts(t *testing.T) {
+	pwnedClient := PwnedClient{
+		ConnectTimeout:        time.Second,
+		ResponseHeaderTimeout: 2 * time.Second,
+	}
+
+	client, ok := pwnedClient.httpClient().(*http.Client)
+	if !ok || client == http.DefaultClient || client == sharedHTTPClient() {
+		t.Fatalf("Expected a new *http.Client")
+	}
+
+	transport := client.Transport.(*http.Transport)
+
+	if transport.ResponseHeaderTimeout != 2*time.Second {
+		t.Errorf("Unexpected ResponseHeaderTimeout %v", transport.ResponseHeaderTimeout)
+	}
+
+	if transport.DialContext == nil {
+		t.Errorf("Expected DialContext to be set")
+	}
+
+	if pwnedClient.httpClient() != client {
+		t.Errorf("Expected the same client to be reused")
+	}
+}
+
+func TestDialerSettings(t *testing.T) {
+	pwnedClient := PwnedClient{
+		FallbackDelay: 50 * time.Millisecond,
+	}
+
+	dialer := pwnedClient.newDialer()
+
+	if dialer.Timeout != DefaultConnectTimeout || dialer.FallbackDelay != 50*time.Millisecond {
+		t.Errorf("Unexpected dialer %+v", dialer)
+	}
+
+	client, ok := pwnedClient.httpClient().(*http.Client)
+	if !ok || client == sharedHTTPClient() {
+		t.Fatalf("Expected a new *http.Client")
+	}
+
+	if client.Transport.(*http.Transport).DialContext == nil {
+		t.Errorf("Expected DialContext to be set")
+	}
+}
+
+func TestIPv4Only(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("214943DAAD1D64C102FAEC29DE4AFE9DA3D:1\r\n"))
+	}))
+	defer server.Close()
+
+	pwnedClient := PwnedClient{
+		BaseURL:  server.URL + "/range/",
+		IPv4Only: true,
+	}
+
+	if _, err := pwnedClient.Check(context.Background(), "password1"); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	// IPv6 addresses are never dialed
+	pwnedClient = PwnedClient{
+		BaseURL:  "http://[::1]:1/range/",
+		IPv4Only: true,
+	}
+
+	_, err := pwnedClient.Check(context.Background(), "password1")
+
+	var addrErr *net.AddrError
+	if !errors.As(err, &addrErr) {
+		t.Errorf("Expected an address error, got %v", err)
+	}
+}
+
+func TestResponseHeaderTimeout(t *testing.T) {
+	release := make(chan struct{})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	pwnedClient := PwnedClient{
+		ResponseHeaderTimeout: 10 * time.Millisecond,
+	}
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	_, err = pwnedClient.httpClient().Do(req)
+	if err == nil {
+		t.Errorf("Expected response header timeout error")
+	}
+}
+
+func TestProxy(t *testing.T) {
+	var proxied []string
+
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// proxies receive the absolute URL
+		proxied = append(proxied, r.URL.String())
+
+		w.Write([]byte("214943DAAD1D64C102FAEC29DE4AFE9DA3D:1\r\n"))
+	}))
+	defer proxy.Close()
+
+	proxyURL, err := url.Parse(proxy.URL)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	consulted := 0
+
+	pwnedClient := PwnedClient{
+		BaseURL: "http://pwnedpasswords.invalid/range/",
+		Proxy: func(r *http.Request) (*url.URL, error) {
+			consulted += 1
+
+			return proxyURL, nil
+		},
+	}
+
+	pwned, err := pwnedClient.Check(context.Background(), "password1")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if !pwned {
+		t.Errorf("Expected result to be true, but was false")
+	}
+
+	if consulted != 1 || len(proxied) != 1 || proxied[0] != "http://pwnedpasswords.invalid/range/E38AD" {
+		t.Errorf("Expected the request to be sent through the proxy, got %d %q", consulted, proxied)
+	}
+
+	// the proxy is ignored for custom clients
+	httpClient := &testHTTPClient{}
+
+	pwnedClient = PwnedClient{
+		HTTP:  httpClient,
+		Proxy: http.ProxyURL(proxyURL),
+	}
+
+	if pwnedClient.httpClient() != httpClient {
+		t.Errorf("Expected HTTP to be used")
+	}
+}
+
+func TestRootCAsAndPinning(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("214943DAAD1D64C102FAEC29DE4AFE9DA3D:1\r\n"))
+	}))
+	defer server.Close()
+
+	rootCAs := x509.NewCertPool()
+	rootCAs.AddCert(server.Certificate())
+
+	pin := publicKeyPin(server.Certificate())
+
+	examples := []struct {
+		RootCAs          *x509.CertPool
+		PinnedPublicKeys []string
+		NotPinned        bool
+		Failed           bool
+	}{
+		{nil, nil, false, true},
+		{rootCAs, nil, false, false},
+		{rootCAs, []string{"AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA=", pin}, false, false},
+		{rootCAs, []string{"AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA="}, true, true},
+	}
+
+	for i, example := range examples {
+		pwnedClient := PwnedClient{
+			BaseURL:          server.URL + "/range/",
+			RootCAs:          example.RootCAs,
+			PinnedPublicKeys: example.PinnedPublicKeys,
+		}
+
+		pwned, err := pwnedClient.Check(context.Background(), "password1")
+
+		if failed := err != nil; failed != example.Failed || (!failed && !pwned) {
+			t.Errorf("Example %d: unexpected result %v %v", i, pwned, err)
+		}
+
+		if notPinned := errors.Is(err, ErrCertificateNotPinned); notPinned != example.NotPinned {
+			t.Errorf("Example %d: unexpected error %v", i, err)
+		}
+	}
+}
+
+func BenchmarkTransportConnectionReuse(b *testing.B) {
+	for _, example := range []struct {
+		name      string
+		transport func() *http.Transport
+	}{
+		{"http.DefaultTransport", func() *http.Transport { return http.DefaultTransport.(*http.Transport).Clone() }},
+		{"DefaultTransport", DefaultTransport},
+	} {
+		b.Run(example.name, func(b *testing.B) {
+			conns := int64(0)
+
+			server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("214943DAAD1D64C102FAEC29DE4AFE9DA3D:1\r\n"))
+			}))
+			server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+				if state == http.StateNew {
+					atomic.AddInt64(&conns, 1)
+				}
+			}
+			server.Start()
+			defer server.Close()
+
+			transport := example.transport()
+			defer transport.CloseIdleConnections()
+
+			pwnedClient := PwnedClient{
+				BaseURL: server.URL + "/range/",
+				HTTP: &http.Client{
+					Transport: transport,
+				},
+			}
+
+			prefix := 0
+
+			b.ResetTimer()
+
+			// each op is a burst of concurrent checks of distinct
+			// prefixes, as during a signup spike
+			for i := 0; i < b.N; i += 1 {
+				wg := &sync.WaitGroup{}
+
+				for j := 0; j < 16; j += 1 {
+					prefix += 1
+					hash := fmt.Sprintf("%05X%035d", prefix%0x100000, 0)
+
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+
+						if _, err := pwnedClient.CheckHash(context.Background(), hash); err != nil {
+							b.Errorf("Unexpected error %v", err)
+						}
+					}()
+				}
+
+				wg.Wait()
+			}
+
+			b.ReportMetric(float64(atomic.LoadInt64(&conns))/float64(b.N), "conns/op")
+		})
+	}
+}
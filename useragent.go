@@ -0,0 +1,92 @@
+package hibp
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// userAgentContextKey is the context key for the User-Agent override set with
+// ContextWithUserAgent.
+type userAgentContextKey struct{}
+
+// ContextWithUserAgent returns a context that overrides the User-Agent sent by
+// PwnedClient and BreachClient for requests made with it, such as to attribute
+// requests to the originating tenant in a multi-tenant gateway sharing a single
+// client. An empty User-Agent falls back to the client's UserAgent, then to
+// DefaultUserAgent. Concurrent checks that share a single request use the
+// User-Agent of the check that started it.
+func ContextWithUserAgent(ctx context.Context, userAgent string) context.Context {
+	return context.WithValue(ctx, userAgentContextKey{}, userAgent)
+}
+
+// userAgentFromContext returns the User-Agent set with ContextWithUserAgent,
+// or an empty string if not set.
+func userAgentFromContext(ctx context.Context) string {
+	userAgent, _ := ctx.Value(userAgentContextKey{}).(string)
+
+	return userAgent
+}
+
+// userAgentMarker identifies this library in User-Agent headers built with
+// BuildUserAgent.
+const userAgentMarker = "hibp-go (+https://github.com/supabase/hibp)"
+
+// BuildUserAgent builds a User-Agent identifying your application per the
+// HaveIBeenPwned.org API rules, in the form:
+//
+//	appName/appVersion (+contact) hibp-go (+https://github.com/supabase/hibp)
+//
+// The API rules require all three pieces. BuildUserAgent does not enforce
+// this: surrounding whitespace is trimmed from all pieces and empty pieces are
+// omitted, and if appName is empty only the library marker is returned. Use
+// BuildUserAgentStrict to get an error instead.
+func BuildUserAgent(appName, appVersion, contact string) string {
+	appName = strings.TrimSpace(appName)
+	appVersion = strings.TrimSpace(appVersion)
+	contact = strings.TrimSpace(contact)
+
+	if appName == "" {
+		return userAgentMarker
+	}
+
+	var b strings.Builder
+
+	b.WriteString(strings.ReplaceAll(appName, " ", "-"))
+
+	if appVersion != "" {
+		b.WriteString("/")
+		b.WriteString(strings.ReplaceAll(appVersion, " ", "-"))
+	}
+
+	if contact != "" {
+		b.WriteString(" (+")
+		b.WriteString(contact)
+		b.WriteString(")")
+	}
+
+	b.WriteString(" ")
+	b.WriteString(userAgentMarker)
+
+	return b.String()
+}
+
+// BuildUserAgentStrict is like BuildUserAgent but returns an error if
+// appName, appVersion or contact is empty after trimming surrounding
+// whitespace, instead of silently omitting it.
+func BuildUserAgentStrict(appName, appVersion, contact string) (string, error) {
+	for _, piece := range []struct {
+		name  string
+		value string
+	}{
+		{"appName", appName},
+		{"appVersion", appVersion},
+		{"contact", contact},
+	} {
+		if strings.TrimSpace(piece.value) == "" {
+			return "", fmt.Errorf("hibp: BuildUserAgentStrict requires a non-empty %s", piece.name)
+		}
+	}
+
+	return BuildUserAgent(appName, appVersion, contact), nil
+}
@@ -0,0 +1,119 @@
+package hibp
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestBuildUserAgent(t *testing.T) {
+	examples := []struct {
+		AppName    string
+		AppVersion string
+		Contact    string
+		Expected   string
+	}{
+		{
+			AppName:    "my-app",
+			AppVersion: "1.2.3",
+			Contact:    "security@example.com",
+			Expected:   "my-app/1.2.3 (+security@example.com) hibp-go (+https://github.com/supabase/hibp)",
+		},
+		{
+			AppName:    " My App ",
+			AppVersion: "1.2.3",
+			Contact:    "",
+			Expected:   "My-App/1.2.3 hibp-go (+https://github.com/supabase/hibp)",
+		},
+		{
+			AppName:    "my-app",
+			AppVersion: "",
+			Contact:    "https://example.com",
+			Expected:   "my-app (+https://example.com) hibp-go (+https://github.com/supabase/hibp)",
+		},
+		{
+			AppName:    "",
+			AppVersion: "1.2.3",
+			Contact:    "security@example.com",
+			Expected:   "hibp-go (+https://github.com/supabase/hibp)",
+		},
+	}
+
+	for i, example := range examples {
+		userAgent := BuildUserAgent(example.AppName, example.AppVersion, example.Contact)
+
+		if userAgent != example.Expected {
+			t.Errorf("Unexpected User-Agent for example %d %q expected %q", i, userAgent, example.Expected)
+		}
+	}
+}
+
+func TestBuildUserAgentStrict(t *testing.T) {
+	userAgent, err := BuildUserAgentStrict(" my-app ", "1.2.3", "security@example.com")
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	if expected := "my-app/1.2.3 (+security@example.com) hibp-go (+https://github.com/supabase/hibp)"; userAgent != expected {
+		t.Errorf("Unexpected User-Agent %q expected %q", userAgent, expected)
+	}
+
+	examples := []struct {
+		AppName    string
+		AppVersion string
+		Contact    string
+		Expected   string
+	}{
+		{"", "1.2.3", "security@example.com", "hibp: BuildUserAgentStrict requires a non-empty appName"},
+		{"my-app", " ", "security@example.com", "hibp: BuildUserAgentStrict requires a non-empty appVersion"},
+		{"my-app", "1.2.3", "", "hibp: BuildUserAgentStrict requires a non-empty contact"},
+	}
+
+	for i, example := range examples {
+		userAgent, err := BuildUserAgentStrict(example.AppName, example.AppVersion, example.Contact)
+		if err == nil || err.Error() != example.Expected {
+			t.Errorf("Unexpected error for example %d %v expected %q", i, err, example.Expected)
+		}
+
+		if userAgent != "" {
+			t.Errorf("Unexpected User-Agent for example %d %q", i, userAgent)
+		}
+	}
+}
+
+func TestStrictUserAgent(t *testing.T) {
+	calls := 0
+
+	pwnedClient := PwnedClient{
+		StrictUserAgent: true,
+		HTTP:            testStatusSequenceClient(&calls, []int{http.StatusOK}, nil),
+	}
+
+	for _, userAgent := range []string{"", DefaultUserAgent} {
+		pwnedClient.UserAgent = userAgent
+
+		_, err := pwnedClient.Check(context.Background(), "password1")
+		if !errors.Is(err, ErrMissingUserAgent) {
+			t.Errorf("Unexpected error %v for User-Agent %q", err, userAgent)
+		}
+	}
+
+	if calls != 0 {
+		t.Errorf("Expected no requests without a User-Agent, got %d", calls)
+	}
+
+	pwnedClient.UserAgent = ""
+
+	_, err := pwnedClient.Check(ContextWithUserAgent(context.Background(), "my-app/1.0"), "password1")
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	pwnedClient.UserAgent = "my-app/1.0"
+
+	_, err = pwnedClient.Check(context.Background(), "password2")
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+}
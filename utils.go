@@ -1,13 +1,17 @@
 package hibp
 
 import (
+	"context"
+	"io"
 	"sync/atomic"
+	"time"
 )
 
 // refcountBox maintains a reference count. When the reference count drops to
-// 0, OnRelease is called.
+// 0, OnRelease is called and the box is released for good: it cannot be
+// acquired again, so that it is never handed out while releasing.
 type refcountBox[T any] struct {
-	// Refcount is the current reference count.
+	// Refcount is the current reference count, or -1 once released.
 	Refcount int32
 
 	// OnRelease is a function called when reference count drops to 0.
@@ -17,16 +21,83 @@ type refcountBox[T any] struct {
 	Value T
 }
 
-// Acquire increases the reference count by 1.
+// Acquire increases the reference count by 1. The box must not have been
+// released.
 func (b *refcountBox[T]) Acquire() {
-	atomic.AddInt32(&b.Refcount, 1)
+	if !b.TryAcquire() {
+		panic("hibp: refcountBox acquired after it was released")
+	}
+}
+
+// TryAcquire increases the reference count by 1, unless the box has already
+// been released, in which case it returns false and the box must not be used.
+func (b *refcountBox[T]) TryAcquire() bool {
+	for {
+		refcount := atomic.LoadInt32(&b.Refcount)
+		if refcount < 0 {
+			return false
+		}
+
+		if atomic.CompareAndSwapInt32(&b.Refcount, refcount, refcount+1) {
+			return true
+		}
+	}
 }
 
 // Release decreases the reference count by 1 and calls OnRelease when it drops
-// to 0.
+// to 0, marking the box as released.
 func (b *refcountBox[T]) Release() {
-	if atomic.AddInt32(&b.Refcount, -1) == 0 {
-		b.OnRelease()
-		b.OnRelease = nil
+	for {
+		refcount := atomic.LoadInt32(&b.Refcount)
+
+		next := refcount - 1
+		if next == 0 {
+			next = -1
+		}
+
+		if atomic.CompareAndSwapInt32(&b.Refcount, refcount, next) {
+			if next < 0 {
+				b.OnRelease()
+				b.OnRelease = nil
+			}
+
+			return
+		}
+	}
+}
+
+// now and sleep are the clock used by time-based logic, such as TTL expiry,
+// retry backoff, coalescing windows and circuit breaker cooldowns, so that
+// tests can replace them to drive it deterministically.
+var (
+	now   = time.Now
+	sleep = sleepContext
+)
+
+// sleepContext waits for the duration to pass, returning early with the
+// context's error if it is canceled first.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+
+	case <-ctx.Done():
+		return ctx.Err()
 	}
 }
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+
+	return n, err
+}
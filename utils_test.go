@@ -1,9 +1,75 @@
 package hibp
 
 import (
+	"context"
+	"sync"
 	"testing"
+	"time"
 )
 
+// fakeClock replaces the clock of the package with one that only moves when
+// advanced or slept on.
+type fakeClock struct {
+	lock   sync.Mutex
+	time   time.Time
+	sleeps []time.Duration
+}
+
+// useFakeClock replaces the clock of the package with a fakeClock for the
+// duration of the test.
+func useFakeClock(t *testing.T) *fakeClock {
+	clock := &fakeClock{
+		time: time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC),
+	}
+
+	now = clock.Now
+	sleep = clock.Sleep
+
+	t.Cleanup(func() {
+		now = time.Now
+		sleep = sleepContext
+	})
+
+	return clock
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.time
+}
+
+// Sleep advances the clock by d right away, unless the context is done.
+func (c *fakeClock) Sleep(ctx context.Context, d time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.time = c.time.Add(d)
+	c.sleeps = append(c.sleeps, d)
+
+	return nil
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.time = c.time.Add(d)
+}
+
+// Sleeps returns the durations slept so far.
+func (c *fakeClock) Sleeps() []time.Duration {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return append([]time.Duration(nil), c.sleeps...)
+}
+
 func TestRefcountBoxRelease(t *testing.T) {
 	releaseCalled := false
 
@@ -20,3 +86,27 @@ func TestRefcountBoxRelease(t *testing.T) {
 		t.Error("OnRelease was not called")
 	}
 }
+
+func TestRefcountBoxNotAcquiredAfterRelease(t *testing.T) {
+	released := 0
+
+	box := refcountBox[any]{
+		OnRelease: func() {
+			released += 1
+		},
+	}
+
+	if !box.TryAcquire() {
+		t.Fatalf("Expected a new box to be acquired")
+	}
+
+	box.Release()
+
+	if box.TryAcquire() {
+		t.Errorf("Expected a released box not to be acquired")
+	}
+
+	if released != 1 {
+		t.Errorf("Expected OnRelease to be called once, got %d", released)
+	}
+}